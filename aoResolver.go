@@ -6,9 +6,14 @@ import "reflect"
 type AOResolver func(discovery Discovery, item interface{}) (interface{}, error)
 
 // AOResolverMapping binds an item wrapper (AO) with a function that can instance it
+//
+//	Notes
+//		Dependencies is optional and declares the items that the creator
+//		acquires from discovery
 type AOResolverMapping struct {
-	Type    reflect.Type
-	Creator AOResolver
+	Type         reflect.Type
+	Creator      AOResolver
+	Dependencies []ItemKey
 }
 
 // AOItemResolver provides the ability to add and retrieve AO mappings
@@ -16,5 +21,6 @@ type AOItemResolver interface {
 	GetAOMappings(itemType reflect.Type) ([]AOResolverMapping, bool)
 	AddAOMapping(mapping AOResolverMapping)
 	AddAOMappings(mapping []AOResolverMapping)
+	RemoveAOMapping(itemType reflect.Type, options MappingOptions) bool
 	WrapAO(d Discovery, itemType reflect.Type, item interface{}) (interface{}, error)
 }
@@ -0,0 +1,128 @@
+package discovery
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+)
+
+// ConflictPolicy determines what happens when an item or mapping is
+// registered for a key that already has one
+type ConflictPolicy int32
+
+const (
+	// CpReplace replaces the existing registration (the default)
+	CpReplace ConflictPolicy = iota
+	// CpWarn replaces the existing registration and reports the conflict via
+	// ConflictWarning
+	CpWarn
+	// CpKeepFirst keeps the existing registration and ignores the new one
+	CpKeepFirst
+	// CpError keeps the existing registration and rejects the new one with a
+	// *DuplicateError
+	CpError
+)
+
+// String returns the name of the policy
+func (p ConflictPolicy) String() string {
+	switch p {
+	case CpReplace:
+		return "replace"
+	case CpWarn:
+		return "warn"
+	case CpKeepFirst:
+		return "keep-first"
+	case CpError:
+		return "error"
+	}
+
+	return "unknown"
+}
+
+// ConflictWarning is called with the conflicts that are replaced under
+// CpWarn. The default logs the conflict via the standard logger
+//
+//	Notes
+//		ConflictWarning is not synchronized, assign it before registrations
+//		are made
+var ConflictWarning = func(err error) {
+	log.Print(err)
+}
+
+// resolvedSource is the source of items that were created by resolution
+const resolvedSource = "resolution"
+
+// apply applies the policy to a registration of key from source that
+// conflicts with the registration from existing, and returns true if the
+// new registration should be stored
+func (p ConflictPolicy) apply(kind string, key ItemKey, source, existing string) (bool, error) {
+	switch p {
+	case CpWarn:
+		ConflictWarning(newDuplicateError(kind, key, source, existing))
+	case CpKeepFirst:
+		return false, nil
+	case CpError:
+		return false, newDuplicateError(kind, key, source, existing)
+	}
+
+	return true, nil
+}
+
+// DuplicateError is returned when a registration is rejected by CpError
+//
+//	Notes
+//		Source and Existing are the locations (file:line) of the rejected and
+//		existing registrations. Existing is "resolution" for items that were
+//		created by discovery
+type DuplicateError struct {
+	Kind     string
+	Key      ItemKey
+	Source   string
+	Existing string
+
+	template error
+}
+
+func newDuplicateError(kind string, key ItemKey, source, existing string) error {
+	return &DuplicateError{
+		Kind:     kind,
+		Key:      key,
+		Source:   source,
+		Existing: existing,
+		template: ErrDuplicateRegistration.Instance(kind, key, source, existing),
+	}
+}
+
+func (e *DuplicateError) Error() string        { return e.template.Error() }
+func (e *DuplicateError) Unwrap() error        { return e.template }
+func (e *DuplicateError) Is(target error) bool { return target == ErrDuplicate }
+
+// callerSource returns the file:line of the first caller outside of the
+// discovery package, which is where a registration came from
+func callerSource() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+
+	for {
+		frame, more := frames.Next()
+		if !inPackage(frame) {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// inPackage returns true for frames of the discovery package (but not its
+// tests), including the closures of generic helpers such as Provide
+func inPackage(frame runtime.Frame) bool {
+	const pkg = "github.com/gotomgo/discovery."
+
+	if strings.HasSuffix(frame.File, "_test.go") {
+		return false
+	}
+
+	return strings.HasPrefix(frame.Function, pkg)
+}
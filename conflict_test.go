@@ -0,0 +1,113 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolverConflictPolicy(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.SetConflictPolicy(CpError)
+	resolver.AddMapping(versionMapping(1))
+
+	err := resolver.TryAddMapping(versionMapping(2))
+	assert.ErrorIs(t, err, ErrDuplicate)
+
+	var dup *DuplicateError
+	if assert.ErrorAs(t, err, &dup) {
+		assert.Equal(t, TypeKey(versionedType), dup.Key)
+		assert.Contains(t, dup.Source, "conflict_test.go:")
+		assert.Contains(t, dup.Existing, "conflict_test.go:")
+		assert.NotEqual(t, dup.Source, dup.Existing)
+		assert.Contains(t, err.Error(), dup.Existing)
+	}
+
+	assert.Panics(t, func() { resolver.AddMapping(versionMapping(2)) })
+
+	// mappings are added together, or not at all
+	other := ResolverMapping{Type: testItemType, Creator: dependsOn()}
+	assert.Error(t, resolver.TryAddMappings([]ResolverMapping{other, versionMapping(2)}))
+	_, ok := resolver.GetMapping(testItemType)
+	assert.False(t, ok)
+	assert.Error(t, resolver.TryAddMappings([]ResolverMapping{other, other}))
+
+	// generic helpers report the caller
+	d := NewItemDiscovery(resolver)
+	err = Provide(d, func(d Discovery) (*versionedItem, error) { return nil, nil })
+	if assert.ErrorAs(t, err, &dup) {
+		assert.Contains(t, dup.Source, "conflict_test.go:")
+	}
+
+	// replacing is explicit, and not subject to the policy
+	assert.True(t, resolver.ReplaceMapping(versionMapping(3), MoNone))
+
+	item, err := Get[*versionedItem](d)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, item.version)
+
+	resolver.SetConflictPolicy(CpKeepFirst)
+	assert.NoError(t, resolver.TryAddMapping(versionMapping(4)))
+	mapping, _ := resolver.GetMapping(versionedType)
+	created, _ := mapping.Creator(d)
+	assert.Equal(t, 3, created.(*versionedItem).version)
+}
+
+func TestConflictWarning(t *testing.T) {
+	var warnings []error
+	previous := ConflictWarning
+	ConflictWarning = func(err error) { warnings = append(warnings, err) }
+	t.Cleanup(func() { ConflictWarning = previous })
+
+	resolver := NewBaseItemResolver()
+	resolver.SetConflictPolicy(CpWarn)
+	resolver.AddMapping(versionMapping(1))
+	resolver.AddMapping(versionMapping(2))
+
+	if assert.Len(t, warnings, 1) {
+		assert.ErrorIs(t, warnings[0], ErrDuplicate)
+	}
+
+	d := NewItemDiscovery(resolver)
+	item, err := Get[*versionedItem](d)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, item.version)
+}
+
+func TestDiscoveryConflictPolicy(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.AddMapping(versionMapping(1))
+
+	d := NewItemDiscovery(resolver)
+	d.SetConflictPolicy(CpError)
+
+	first := &versionedItem{version: 10}
+	assert.NoError(t, Set(d, first))
+
+	err := Set(d, &versionedItem{version: 11})
+	var dup *DuplicateError
+	if assert.ErrorAs(t, err, &dup) {
+		assert.Equal(t, "item", dup.Kind)
+		assert.Contains(t, dup.Source, "conflict_test.go:")
+		assert.Contains(t, dup.Existing, "conflict_test.go:")
+	}
+
+	item, _ := Get[*versionedItem](d)
+	assert.Same(t, first, item)
+
+	// resolved items are registrations too
+	d.RemoveItem(versionedType)
+	_, err = Get[*versionedItem](d)
+	assert.NoError(t, err)
+
+	err = d.AddOwnedItem(TypeKey(versionedType), first)
+	if assert.ErrorAs(t, err, &dup) {
+		assert.Equal(t, resolvedSource, dup.Existing)
+	}
+
+	// items that are not stored are not owned
+	d.SetConflictPolicy(CpKeepFirst)
+	owned := len(d.ownedItems())
+	assert.NoError(t, d.AddOwnedItem(TypeKey(versionedType), first))
+	assert.Len(t, d.ownedItems(), owned)
+}
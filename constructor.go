@@ -0,0 +1,96 @@
+package discovery
+
+import (
+	"context"
+	"reflect"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+var discoveryType = reflect.TypeOf((*Discovery)(nil)).Elem()
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// NewConstructorMapping creates a ResolverMapping from a constructor such
+// as func(Logger, *Config) (*Service, error)
+//
+//	Params
+//	  constructor - a func that returns T or (T, error)
+//
+//	Notes
+//		The mapping resolves T. Each parameter of the constructor is acquired
+//		from discovery by type and declared as a dependency of the mapping,
+//		except for parameters of type Discovery and context.Context, which
+//		receive the discovery and context of the resolution
+//
+//		Name and Lifetime of the returned mapping can be set before it is
+//		added to a resolver
+func NewConstructorMapping(constructor interface{}) (ResolverMapping, error) {
+	fn := reflect.ValueOf(constructor)
+	fnType := reflect.TypeOf(constructor)
+
+	if (fnType == nil) || (fnType.Kind() != reflect.Func) || fn.IsNil() {
+		return ResolverMapping{}, ErrInvalidConstructor.Instance(fnType, "not a func")
+	}
+
+	if fnType.IsVariadic() {
+		return ResolverMapping{}, ErrInvalidConstructor.Instance(fnType, "variadic parameters are not supported")
+	}
+
+	switch {
+	case fnType.NumOut() == 1:
+	case (fnType.NumOut() == 2) && (fnType.Out(1) == errorType):
+	default:
+		return ResolverMapping{}, ErrInvalidConstructor.Instance(fnType, "must return T or (T, error)")
+	}
+
+	var deps []ItemKey
+	for i := 0; i < fnType.NumIn(); i++ {
+		if in := fnType.In(i); (in != discoveryType) && (in != contextType) {
+			deps = append(deps, TypeKey(in))
+		}
+	}
+
+	return ResolverMapping{
+		Type:         fnType.Out(0),
+		Dependencies: deps,
+		Creator: func(d Discovery) (interface{}, error) {
+			args := make([]reflect.Value, fnType.NumIn())
+
+			for i := range args {
+				switch in := fnType.In(i); in {
+				case discoveryType:
+					args[i] = reflect.ValueOf(&d).Elem()
+				case contextType:
+					args[i] = reflect.ValueOf(ResolveContext(d))
+				default:
+					arg, err := d.GetItem(in)
+					if err != nil {
+						return nil, err
+					}
+					if !isItemType(in, arg, false) {
+						return nil, newItemTypeError(errorContext(d, TypeKey(in)), in, arg, "")
+					}
+					args[i] = reflect.ValueOf(arg).Convert(in)
+				}
+			}
+
+			out := fn.Call(args)
+
+			if (len(out) == 2) && !out[1].IsNil() {
+				return nil, out[1].Interface().(error)
+			}
+
+			return out[0].Interface(), nil
+		},
+	}, nil
+}
+
+// ProvideConstructor adds a mapping for the result type of constructor
+// (see NewConstructorMapping)
+func (r *BaseItemResolver) ProvideConstructor(constructor interface{}) error {
+	mapping, err := NewConstructorMapping(constructor)
+	if err != nil {
+		return err
+	}
+
+	return r.TryAddMapping(mapping)
+}
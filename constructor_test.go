@@ -0,0 +1,68 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type wiredService struct {
+	mock *MockService
+	item testItem
+	ctx  context.Context
+}
+
+func TestProvideConstructor(t *testing.T) {
+	resolver := NewBaseItemResolver()
+
+	assert.NoError(t, resolver.ProvideConstructor(func() *MockService {
+		return &MockService{field: 7}
+	}))
+	assert.NoError(t, resolver.ProvideConstructor(func(ctx context.Context, d Discovery, mock *MockService, item testItem) (*wiredService, error) {
+		return &wiredService{mock: mock, item: item, ctx: ctx}, nil
+	}))
+
+	wiredType := TypeOf[*wiredService]()
+
+	mapping, ok := resolver.GetMapping(wiredType)
+	assert.True(t, ok)
+	assert.Equal(t, []ItemKey{TypeKey(MockServiceType), TypeKey(testItemType)}, mapping.Dependencies)
+
+	d := NewItemDiscovery(resolver)
+
+	// testItem is missing
+	_, err := d.GetItem(wiredType)
+	assert.Error(t, err)
+
+	assert.NoError(t, d.AddItem(testItemType, &testItemImpl{}))
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	item, err := d.GetItemContext(ctx, wiredType)
+	assert.NoError(t, err)
+
+	service := item.(*wiredService)
+	assert.Equal(t, 7, service.mock.field)
+	assert.NotNil(t, service.item)
+	assert.Equal(t, "value", service.ctx.Value(ctxKey{}))
+}
+
+func TestProvideConstructorErrors(t *testing.T) {
+	resolver := NewBaseItemResolver()
+
+	assert.Error(t, resolver.ProvideConstructor(nil))
+	assert.Error(t, resolver.ProvideConstructor(42))
+	assert.Error(t, resolver.ProvideConstructor(func() {}))
+	assert.Error(t, resolver.ProvideConstructor(func() (*MockService, int) { return nil, 0 }))
+	assert.Error(t, resolver.ProvideConstructor(func(...int) *MockService { return nil }))
+
+	failed := errors.New("failed")
+	assert.NoError(t, resolver.ProvideConstructor(func() (*MockService, error) {
+		return nil, failed
+	}))
+
+	_, err := NewItemDiscovery(resolver).GetItem(MockServiceType)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed")
+}
@@ -1,10 +1,14 @@
 package discovery
 
-import "reflect"
+import (
+	"context"
+	"reflect"
+)
 
 // Discovery is the primary interface for finding/acquiring items via discovery
 type Discovery interface {
 	HasItem(itemType reflect.Type) bool
+	HasKeyedItem(key ItemKey) bool
 
 	GetItem(itemType reflect.Type) (interface{}, error)
 	GetRequiredItem(itemType reflect.Type) interface{}
@@ -12,6 +16,19 @@ type Discovery interface {
 	GetItemWithOptions(itemType reflect.Type, options ResolveOptions) (interface{}, error)
 	GetRequiredItemWithOptions(itemType reflect.Type, options ResolveOptions) (interface{}, error)
 
+	// GetKeyedItem and friends are equivalent to the reflect.Type based methods
+	// but address named items (see ItemKey)
+	GetKeyedItem(key ItemKey) (interface{}, error)
+	GetRequiredKeyedItem(key ItemKey) interface{}
+	GetKeyedItemWithOptions(key ItemKey, options ResolveOptions) (interface{}, error)
+
+	// GetItemContext and friends resolve items with a context that is passed
+	// to nested resolutions and to ContextCreator. Waiting for another caller
+	// that is resolving the same item stops when ctx is done
+	GetItemContext(ctx context.Context, itemType reflect.Type) (interface{}, error)
+	GetItemWithOptionsContext(ctx context.Context, itemType reflect.Type, options ResolveOptions) (interface{}, error)
+	GetKeyedItemWithOptionsContext(ctx context.Context, key ItemKey, options ResolveOptions) (interface{}, error)
+
 	// WrapAO can be used to resolve an AO item wrapper when an item is NOT
 	// automatically wrapped because the item is created directly and NOT via discovery
 	WrapAO(itemType reflect.Type, item interface{}) (interface{}, error)
@@ -1,6 +1,9 @@
 package discovery
 
-import "reflect"
+import (
+	"context"
+	"reflect"
+)
 
 // ItemDiscoveryManagement provides the ability to add and remove discovery items
 type ItemDiscoveryManagement interface {
@@ -8,6 +11,14 @@ type ItemDiscoveryManagement interface {
 
 	AddItem(itemType reflect.Type, item interface{}) error
 	RemoveItem(itemType reflect.Type)
+
+	AddKeyedItem(key ItemKey, item interface{}) error
+	AddOwnedItem(key ItemKey, item interface{}) error
+	RemoveKeyedItem(key ItemKey)
+
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	Shutdown(ctx context.Context) error
 }
 
 // ItemDiscoveryManagementType is the reflected type of ItemDiscoveryManagement
@@ -0,0 +1,390 @@
+package discovery
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// benchDiscovery returns a discovery with n resolved items, and the key of
+// one of them
+func benchDiscovery(b *testing.B, n int) (*ItemDiscovery, ItemKey) {
+	resolver := NewBaseItemResolver()
+	for i := 0; i < n; i++ {
+		version := i
+		resolver.AddMapping(ResolverMapping{
+			Type: versionedType,
+			Name: fmt.Sprint(i),
+			Creator: func(d Discovery) (interface{}, error) {
+				return &versionedItem{version: version}, nil
+			}})
+	}
+	resolver.AddMapping(versionMapping(0))
+
+	d := NewItemDiscovery(resolver)
+	for i := 0; i < n; i++ {
+		if _, err := d.GetKeyedItem(NamedKey(versionedType, fmt.Sprint(i))); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if _, err := d.GetItem(versionedType); err != nil {
+		b.Fatal(err)
+	}
+
+	return d, TypeKey(versionedType)
+}
+
+func BenchmarkGetItemCached(b *testing.B) {
+	d, key := benchDiscovery(b, 100)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := d.GetKeyedItem(key); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetItemCachedParallel(b *testing.B) {
+	d, key := benchDiscovery(b, 100)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := d.GetKeyedItem(key); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkGetNamedItemCachedParallel(b *testing.B) {
+	d, _ := benchDiscovery(b, 100)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if _, err := d.GetKeyedItem(NamedKey(versionedType, fmt.Sprint(i%100))); err != nil {
+				b.Error(err)
+				return
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkGetItemFromBaseParallel(b *testing.B) {
+	base, key := benchDiscovery(b, 100)
+	super := NewItemDiscoveryWithBase(base, nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := super.GetKeyedItem(key); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkGenericGetParallel(b *testing.B) {
+	d, _ := benchDiscovery(b, 100)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := Get[*versionedItem](d); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkHasItemParallel(b *testing.B) {
+	d, _ := benchDiscovery(b, 100)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if !d.HasItem(versionedType) {
+				b.Error("item not found")
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkGetItemCachedWithWriters measures cache hits while another
+// goroutine keeps adding items
+func BenchmarkGetItemCachedWithWriters(b *testing.B) {
+	d, key := benchDiscovery(b, 100)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+				_ = d.AddKeyedItem(NamedKey(TypeOf[string](), fmt.Sprint(i%100)), "item")
+			}
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := d.GetKeyedItem(key); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+
+	b.StopTimer()
+	close(done)
+	<-stopped
+}
+
+func BenchmarkAddItem(b *testing.B) {
+	d, _ := benchDiscovery(b, 100)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := d.AddItem(TypeOf[string](), "item"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkResolveTransientParallel(b *testing.B) {
+	resolver := NewBaseItemResolver()
+	mapping := versionMapping(0)
+	mapping.Lifetime = LtTransient
+	resolver.AddMapping(mapping)
+	d := NewItemDiscovery(resolver)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := d.GetItem(versionedType); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkFillCache measures resolving (and caching) n items in a new
+// discovery, which is linear in n
+func BenchmarkFillCache(b *testing.B) {
+	for _, n := range []int{1000, 4000, 16000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			keys := make([]ItemKey, n)
+			mappings := make([]ResolverMapping, n)
+			for i := range mappings {
+				keys[i] = NamedKey(versionedType, fmt.Sprint(i))
+				mappings[i] = ResolverMapping{
+					Type: versionedType,
+					Name: keys[i].Name,
+					Creator: func(d Discovery) (interface{}, error) {
+						return &versionedItem{}, nil
+					}}
+			}
+
+			resolver := NewBaseItemResolver()
+			resolver.AddMappings(mappings)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				d := NewItemDiscovery(resolver)
+				for _, key := range keys {
+					if _, err := d.GetKeyedItem(key); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+// itemStore is the storage of items compared by BenchmarkStore: the storage
+// of ItemDiscovery, and the storages it could use instead
+type itemStore interface {
+	get(key ItemKey) (interface{}, bool)
+	set(key ItemKey, item interface{})
+}
+
+// lockedStore is the storage that ItemDiscovery used before items were read
+// without locking: a map guarded by a sync.RWMutex
+type lockedStore struct {
+	lock  sync.RWMutex
+	items map[ItemKey]interface{}
+}
+
+func (s *lockedStore) get(key ItemKey) (interface{}, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	item, ok := s.items[key]
+	return item, ok
+}
+
+func (s *lockedStore) set(key ItemKey, item interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.items[key] = item
+}
+
+// cowStore is a copy-on-write map behind an atomic.Pointer, whose reads take
+// no lock but whose writes copy the map
+type cowStore struct {
+	lock  sync.Mutex
+	items atomic.Pointer[map[ItemKey]interface{}]
+}
+
+func (s *cowStore) get(key ItemKey) (interface{}, bool) {
+	if p := s.items.Load(); p != nil {
+		item, ok := (*p)[key]
+		return item, ok
+	}
+
+	return nil, false
+}
+
+func (s *cowStore) set(key ItemKey, item interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var current map[ItemKey]interface{}
+	if p := s.items.Load(); p != nil {
+		current = *p
+	}
+
+	next := make(map[ItemKey]interface{}, len(current)+1)
+	for k, v := range current {
+		next[k] = v
+	}
+	next[key] = item
+
+	s.items.Store(&next)
+}
+
+var itemStores = []struct {
+	name  string
+	store func() itemStore
+}{
+	{"rwmutex", func() itemStore { return &lockedStore{items: map[ItemKey]interface{}{}} }},
+	{"cow", func() itemStore { return &cowStore{} }},
+	{"syncmap", func() itemStore { return &syncMap[ItemKey, interface{}]{} }},
+}
+
+// BenchmarkStore compares the storage of ItemDiscovery (syncmap) with the
+// storage it replaced (rwmutex), and with a copy-on-write map (cow)
+func BenchmarkStore(b *testing.B) {
+	keys := make([]ItemKey, 4000)
+	for i := range keys {
+		keys[i] = NamedKey(versionedType, fmt.Sprint(i))
+	}
+
+	for _, s := range itemStores {
+		b.Run("GetParallel/"+s.name, func(b *testing.B) {
+			store := s.store()
+			for _, key := range keys[:100] {
+				store.set(key, &versionedItem{})
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if _, ok := store.get(keys[i%100]); !ok {
+						b.Error("item not found")
+						return
+					}
+					i++
+				}
+			})
+		})
+
+		b.Run("GetWithWriters/"+s.name, func(b *testing.B) {
+			store := s.store()
+			for _, key := range keys[:100] {
+				store.set(key, &versionedItem{})
+			}
+
+			done := make(chan struct{})
+			stopped := make(chan struct{})
+			go func() {
+				defer close(stopped)
+				for i := 0; ; i++ {
+					select {
+					case <-done:
+						return
+					default:
+						store.set(keys[100+i%100], &versionedItem{})
+					}
+				}
+			}()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if _, ok := store.get(keys[i%100]); !ok {
+						b.Error("item not found")
+						return
+					}
+					i++
+				}
+			})
+
+			b.StopTimer()
+			close(done)
+			<-stopped
+		})
+
+		b.Run("Fill/"+s.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				store := s.store()
+				for _, key := range keys {
+					store.set(key, &versionedItem{})
+				}
+			}
+		})
+	}
+}
@@ -2,28 +2,58 @@ package discovery
 
 import (
 	"container/list"
+	"context"
+	stderrors "errors"
 	"reflect"
 	"sync"
+	"sync/atomic"
 
 	"github.com/gotomgo/coreutils/errors"
 )
 
 // ItemDiscovery is the default implementation of Discovery and NamedDiscovery
 type ItemDiscovery struct {
-	lock sync.RWMutex
+	// lock serializes changes to items, which are read without locking
+	lock sync.Mutex
 
-	items         map[reflect.Type]interface{}
+	items         syncMap[ItemKey, interface{}]
+	sources       map[ItemKey]string
 	baseDiscovery Discovery
 
 	listenerLock  sync.Mutex
 	typeListeners *list.List
+	events        []queuedEvent
+	dispatching   bool
 
-	resolveLock  sync.Mutex
-	resolveLocks map[reflect.Type]*sync.Mutex
+	resolveLock sync.Mutex
+	flights     map[ItemKey]*flight
 
-	activeResolvers *list.List
+	ownedLock sync.Mutex
+	owned     *list.List
 
-	resolver ItemResolver
+	lifecycleLock sync.Mutex
+	started       *list.List
+
+	observed map[observableResolver]struct{}
+
+	// supers are the discoveries created with discovery as their base,
+	// whose items may depend on the items of discovery
+	superLock sync.Mutex
+	supers    weakSet[ItemDiscovery]
+
+	moduleLock sync.Mutex
+	modules    []*Module
+	moduleOf   map[ItemKey]*Module
+
+	graphLock    sync.Mutex
+	dependencies map[ItemKey][]ItemKey
+
+	resolver       ItemResolver
+	sharedResolver bool
+
+	strict    atomic.Bool
+	conflicts atomic.Int32
+	frozen    atomic.Int32
 }
 
 var _ Discovery = &ItemDiscovery{}
@@ -76,11 +106,15 @@ func NewItemDiscovery(resolver ItemResolver) *ItemDiscovery {
 	}
 
 	return &ItemDiscovery{
-		items:           map[reflect.Type]interface{}{},
-		resolver:        resolver,
-		resolveLocks:    map[reflect.Type]*sync.Mutex{},
-		activeResolvers: &list.List{},
-		typeListeners:   &list.List{},
+		sources:       map[ItemKey]string{},
+		resolver:      resolver,
+		flights:       map[ItemKey]*flight{},
+		typeListeners: &list.List{},
+		owned:         &list.List{},
+		started:       &list.List{},
+		observed:      map[observableResolver]struct{}{},
+		moduleOf:      map[ItemKey]*Module{},
+		dependencies:  map[ItemKey][]ItemKey{},
 	}
 }
 
@@ -91,47 +125,139 @@ func NewItemDiscovery(resolver ItemResolver) *ItemDiscovery {
 //		resolver is the item resolver used by discovery. if not specified, an
 //		instance of BaseItemResolver is created for use
 //
+//		Items are resolved and cached by the discovery that owns their
+//		mapping, so that concurrent callers of every layer share one flight
+//		and the Creator runs once. If resolver is also the resolver of the
+//		base discovery (or one of its bases), the deepest discovery that uses
+//		it owns its singleton mappings, and the mappings whose declared
+//		Dependencies it resolves without the items of discovery. Every other
+//		mapping is resolved by discovery, so that its Creator can depend on
+//		items added to discovery (e.g. per request). Scoped items are
+//		resolved and cached by every discovery
+//
 //		This constructor is considered *deprecated*. Prefer NewDiscoveryWithBase
 func NewItemDiscoveryWithBase(baseD Discovery, resolver ItemResolver) *ItemDiscovery {
 	if resolver == nil {
 		resolver = NewBaseItemResolver()
 	}
 
-	return &ItemDiscovery{
-		baseDiscovery:   baseD,
-		items:           map[reflect.Type]interface{}{},
-		resolver:        resolver,
-		resolveLocks:    map[reflect.Type]*sync.Mutex{},
-		activeResolvers: &list.List{},
-		typeListeners:   &list.List{},
+	d := &ItemDiscovery{
+		baseDiscovery:  baseD,
+		sources:        map[ItemKey]string{},
+		resolver:       resolver,
+		sharedResolver: sharesResolver(baseD, resolver),
+		flights:        map[ItemKey]*flight{},
+		typeListeners:  &list.List{},
+		owned:          &list.List{},
+		started:        &list.List{},
+		observed:       map[observableResolver]struct{}{},
+		moduleOf:       map[ItemKey]*Module{},
+		dependencies:   map[ItemKey][]ItemKey{},
+	}
+
+	if host, ok := baseD.(superHost); ok {
+		host.addSuper(d)
 	}
+
+	return d
 }
 
 //	--------------------------------------------------------------------------
 //	ItemDiscoveryManagement implementation
 //	--------------------------------------------------------------------------
 
+// SetStrictTypes sets how items added to discovery are type checked
+//
+//	Notes
+//		By default, items must be convertible to their item type. When strict,
+//		items must be assignable to (or implement) the item type
+func (d *ItemDiscovery) SetStrictTypes(strict bool) {
+	d.strict.Store(strict)
+}
+
+// SetConflictPolicy sets what happens when an item is added for a key that
+// already has one (CpReplace by default)
+//
+//	Notes
+//		Items created by resolution are registrations too, so under CpError
+//		an item cannot be added for a key that has already been resolved
+func (d *ItemDiscovery) SetConflictPolicy(policy ConflictPolicy) {
+	d.conflicts.Store(int32(policy))
+}
+
 // AddItem adds an item for discovery by type
 func (d *ItemDiscovery) AddItem(itemType reflect.Type, item interface{}) error {
-	ok := reflect.TypeOf(item).ConvertibleTo(itemType)
+	return d.AddKeyedItem(TypeKey(itemType), item)
+}
 
-	if !ok {
-		return ErrItemNotItemType.Instance(itemType)
-	}
+// AddKeyedItem adds an item for discovery by key
+func (d *ItemDiscovery) AddKeyedItem(key ItemKey, item interface{}) error {
+	_, err := d.addItem(key, item, callerSource())
+	return err
+}
 
-	d.setTypedItem(itemType, item)
+// AddOwnedItem adds an item for discovery by key, and transfers ownership
+// of the item to discovery
+//
+//	Notes
+//		Owned items are stopped or closed by Shutdown, items added via AddItem
+//		or AddKeyedItem are not
+func (d *ItemDiscovery) AddOwnedItem(key ItemKey, item interface{}) error {
+	stored, err := d.addItem(key, item, callerSource())
+	if stored {
+		d.own(key, item, nil, false)
+	}
 
-	return nil
+	return err
 }
 
 // RemoveItem removes an item from discovery by type
+//
+//	Notes
+//		RemoveItem panics if discovery is frozen (see TryRemoveItem)
 func (d *ItemDiscovery) RemoveItem(itemType reflect.Type) {
+	d.RemoveKeyedItem(TypeKey(itemType))
+}
+
+// RemoveKeyedItem removes an item from discovery by key
+//
+//	Notes
+//		RemoveKeyedItem panics if discovery is frozen (see
+//		TryRemoveKeyedItem)
+func (d *ItemDiscovery) RemoveKeyedItem(key ItemKey) {
+	if err := d.TryRemoveKeyedItem(key); err != nil {
+		panic(err)
+	}
+}
+
+// TryRemoveItem removes an item from discovery by type, and returns a
+// *FrozenError if discovery is frozen
+func (d *ItemDiscovery) TryRemoveItem(itemType reflect.Type) error {
+	return d.TryRemoveKeyedItem(TypeKey(itemType))
+}
+
+// TryRemoveKeyedItem removes an item from discovery by key, and returns a
+// *FrozenError if discovery is frozen
+func (d *ItemDiscovery) TryRemoveKeyedItem(key ItemKey) error {
 	d.lock.Lock()
-	defer d.lock.Unlock()
 
-	if _, ok := d.items[itemType]; ok {
-		delete(d.items, itemType)
+	if d.frozen.Load() != notFrozen {
+		d.lock.Unlock()
+		return newFrozenError("remove item", key)
 	}
+
+	if item, ok := d.items.get(key); ok {
+		d.items.delete(key)
+		delete(d.sources, key)
+		d.queueEvent(ItemRemoved, key, item)
+	}
+
+	d.lock.Unlock()
+
+	d.disown(key)
+	d.dispatchEvents()
+
+	return nil
 }
 
 //	--------------------------------------------------------------------------
@@ -144,16 +270,36 @@ func (d *ItemDiscovery) GetResolver() ItemResolver {
 }
 
 func (d *ItemDiscovery) HasItem(itemType reflect.Type) bool {
-	_, ok := d.getTypedItem(itemType)
+	return d.HasKeyedItem(TypeKey(itemType))
+}
+
+func (d *ItemDiscovery) HasKeyedItem(key ItemKey) bool {
+	_, ok := d.getTypedItem(key)
 	return ok
 }
 
 func (d *ItemDiscovery) GetItem(itemType reflect.Type) (interface{}, error) {
-	return d._getTypedItem(itemType, RoNone)
+	return d._getTypedItem(context.Background(), TypeKey(itemType), RoNone, nil)
 }
 
 func (d *ItemDiscovery) GetRequiredItem(itemType reflect.Type) interface{} {
-	item, err := d._getTypedItem(itemType, RoNone)
+	return d.GetRequiredKeyedItem(TypeKey(itemType))
+}
+
+func (d *ItemDiscovery) GetItemWithOptions(itemType reflect.Type, options ResolveOptions) (interface{}, error) {
+	return d._getTypedItem(context.Background(), TypeKey(itemType), options, nil)
+}
+
+func (d *ItemDiscovery) GetRequiredItemWithOptions(itemType reflect.Type, options ResolveOptions) (interface{}, error) {
+	return d._getTypedItem(context.Background(), TypeKey(itemType), options, nil)
+}
+
+func (d *ItemDiscovery) GetKeyedItem(key ItemKey) (interface{}, error) {
+	return d._getTypedItem(context.Background(), key, RoNone, nil)
+}
+
+func (d *ItemDiscovery) GetRequiredKeyedItem(key ItemKey) interface{} {
+	item, err := d._getTypedItem(context.Background(), key, RoNone, nil)
 
 	if err != nil {
 		panic(err)
@@ -162,12 +308,20 @@ func (d *ItemDiscovery) GetRequiredItem(itemType reflect.Type) interface{} {
 	return item
 }
 
-func (d *ItemDiscovery) GetItemWithOptions(itemType reflect.Type, options ResolveOptions) (interface{}, error) {
-	return d._getTypedItem(itemType, options)
+func (d *ItemDiscovery) GetKeyedItemWithOptions(key ItemKey, options ResolveOptions) (interface{}, error) {
+	return d._getTypedItem(context.Background(), key, options, nil)
 }
 
-func (d *ItemDiscovery) GetRequiredItemWithOptions(itemType reflect.Type, options ResolveOptions) (interface{}, error) {
-	return d._getTypedItem(itemType, options)
+func (d *ItemDiscovery) GetItemContext(ctx context.Context, itemType reflect.Type) (interface{}, error) {
+	return d._getTypedItem(ctx, TypeKey(itemType), RoNone, nil)
+}
+
+func (d *ItemDiscovery) GetItemWithOptionsContext(ctx context.Context, itemType reflect.Type, options ResolveOptions) (interface{}, error) {
+	return d._getTypedItem(ctx, TypeKey(itemType), options, nil)
+}
+
+func (d *ItemDiscovery) GetKeyedItemWithOptionsContext(ctx context.Context, key ItemKey, options ResolveOptions) (interface{}, error) {
+	return d._getTypedItem(ctx, key, options, nil)
 }
 
 // WrapAO can be used to resolve an AO item wrapper when a item is NOT
@@ -177,34 +331,124 @@ func (d *ItemDiscovery) WrapAO(itemType reflect.Type, item interface{}) (interfa
 	return d.resolver.(AOItemResolver).WrapAO(d, itemType, item)
 }
 
-func (d *ItemDiscovery) getTypedItem(itemType reflect.Type) (item interface{}, ok bool) {
-	d.lock.RLock()
-	defer d.lock.RUnlock()
-	item, ok = d.items[itemType]
-	return
+func (d *ItemDiscovery) getTypedItem(key ItemKey) (item interface{}, ok bool) {
+	return d.items.get(key)
 }
 
-func (d *ItemDiscovery) setTypedItem(itemType reflect.Type, item interface{}) {
+// addItem adds an item registered at source according to the conflict
+// policy, and returns true if it was stored
+func (d *ItemDiscovery) addItem(key ItemKey, item interface{}, source string) (bool, error) {
+	if !isItemType(key.Type, item, d.strict.Load()) {
+		return false, newItemTypeError(errorContext(d, key), key.Type, item, "")
+	}
+
 	d.lock.Lock()
-	defer d.lock.Unlock()
-	d.items[itemType] = item
+
+	if d.frozen.Load() != notFrozen {
+		d.lock.Unlock()
+		return false, newFrozenError("add item", key)
+	}
+
+	kind := ItemAdded
+	if _, ok := d.items.get(key); ok {
+		existing, ok := d.sources[key]
+		if !ok {
+			existing = resolvedSource
+		}
+
+		if store, err := ConflictPolicy(d.conflicts.Load()).apply("item", key, source, existing); !store {
+			d.lock.Unlock()
+			return false, err
+		}
+
+		kind = ItemReplaced
+	}
+
+	d.items.set(key, item)
+	d.sources[key] = source
+	d.queueEvent(kind, key, item)
+
+	d.lock.Unlock()
+
+	d.dispatchEvents()
+
+	return true, nil
+}
+
+// setResolvedItem caches an item created by resolution, which is owned by
+// discovery
+func (d *ItemDiscovery) setResolvedItem(key ItemKey, item interface{}, deps []ItemKey) {
+	if d.storeItem(key, item, ItemResolved) {
+		d.own(key, item, deps, true)
+	}
+}
+
+// storeItem stores an item and notifies listeners, and returns true if it
+// was stored. ItemAdded is reported as ItemReplaced if an item is already
+// stored for key
+//
+//	Notes
+//		Items are not stored once discovery is sealed, in which case the item
+//		is only returned to the caller that resolved it
+func (d *ItemDiscovery) storeItem(key ItemKey, item interface{}, kind ItemEventKind) bool {
+	d.lock.Lock()
+
+	if d.sealed() {
+		d.lock.Unlock()
+		return false
+	}
+
+	if _, ok := d.items.get(key); ok && (kind == ItemAdded) {
+		kind = ItemReplaced
+	}
+
+	// items stored by resolution have no registration source
+	d.items.set(key, item)
+	delete(d.sources, key)
+	d.queueEvent(kind, key, item)
+
+	d.lock.Unlock()
+
+	d.dispatchEvents()
+
+	return true
 }
 
-func (d *ItemDiscovery) _getTypedItem(itemType reflect.Type, options ResolveOptions) (interface{}, error) {
+func (d *ItemDiscovery) _getTypedItem(ctx context.Context, key ItemKey, options ResolveOptions, parent *resolution) (interface{}, error) {
 	var item interface{}
 	var err error
 
+	mapping, owner, found := d.findMapping(key)
+
+	// the lifetime declared by the mapping wins over the caller's options
+	if found {
+		var conflict string
+		if options, conflict = mapping.Lifetime.applyTo(options); conflict != "" {
+			return nil, newLifetimeError(d.errorContext(parent, key), key, mapping.Lifetime, conflict)
+		}
+	}
+
 	if (options & RoInstanceItem) != 0 {
-		item, err = d.resolveItem(itemType, nil, nil)
+		item, err = d.resolveItem(ctx, key, d.resolveFunc(key, mapping, owner, found, true), parent, nil, nil)
 	} else {
 		var ok bool
 
-		item, ok = d.getTypedItem(itemType)
-
-		if !ok && ((options & RoDontResolve) == 0) {
-			item, err = d.resolveItem(itemType, d.getTypedItem, func(itemType reflect.Type, item interface{}) {
-				d.setTypedItem(itemType, item)
-			})
+		// cache hits take no lock (and do not allocate)
+		item, ok = d.getTypedItem(key)
+
+		// items whose mapping is owned by a base discovery are acquired
+		// from the base, without resolving (or joining a flight) here first.
+		// The same applies to items without a mapping if the resolver is
+		// shared with the base, which would resolve them the same way
+		local := (!found && !d.sharedResolver) || (owner == d) || (mapping.Lifetime == LtScoped)
+
+		if !ok && local && ((options & RoDontResolve) == 0) {
+			if !d.sealed() {
+				item, err = d.resolveItem(ctx, key, d.resolveFunc(key, mapping, owner, found, false), parent, d.getTypedItem, d.cacheFunc(owner, found))
+			} else if found {
+				// a sealed discovery cannot cache what it would resolve
+				err = newFrozenError("resolve", key)
+			}
 		}
 	}
 
@@ -214,107 +458,297 @@ func (d *ItemDiscovery) _getTypedItem(itemType reflect.Type, options ResolveOpti
 
 	if (item == nil) && ((options & RoInstanceItem) == 0) {
 		if d.baseDiscovery != nil {
-			if item, err = d.baseDiscovery.GetItemWithOptions(itemType, options); errors.IsError(err) {
+			if item, err = d.getBaseItem(ctx, key, options, parent); errors.IsError(err) {
 				return nil, err
 			}
 		}
 	}
 
 	if item == nil {
-		return nil, ErrItemNotFound.Instance(itemType)
+		return nil, newNotFoundError(d.errorContext(parent, key), key)
 	}
 
 	return item, nil
 }
 
-type resolveCheckBack func(itemType reflect.Type) (interface{}, bool)
-type resolveSetItem func(itemType reflect.Type, item interface{})
+// resolveFunc returns the resolveFunc of key, given the result of findMapping,
+// for an instance (RoInstanceItem) or an item that is cached
+func (d *ItemDiscovery) resolveFunc(key ItemKey, mapping ResolverMapping, owner *ItemDiscovery, found bool, instance bool) resolveFunc {
+	return func(rd Discovery) (interface{}, error) {
+		if !found {
+			return d.resolver.ResolveKeyedItem(rd, key)
+		}
 
-func (d *ItemDiscovery) resolveItem(itemType reflect.Type, checkBack resolveCheckBack, setItem resolveSetItem) (interface{}, error) {
-	if d.resolver == nil {
-		return nil, nil
+		// instances (including transient items) and scoped items are resolved
+		// by the requesting discovery even if the mapping belongs to a base
+		// discovery. Everything else is resolved (and cached) by the discovery
+		// that owns the mapping
+		if (owner != d) && !instance && (mapping.Lifetime != LtScoped) {
+			return nil, nil
+		}
+
+		return owner.resolver.ResolveMapping(rd, mapping)
+	}
+}
+
+// cacheFunc returns the resolveSetItem that caches the items of key, given
+// the result of findMapping
+//
+//	Notes
+//		Discovery observes the resolver that created the item before the item
+//		is cached, so that the item can be evicted (see MoEvict). Items that
+//		are not cached (e.g. instances) are not observed
+func (d *ItemDiscovery) cacheFunc(owner *ItemDiscovery, found bool) resolveSetItem {
+	resolver := d.resolver
+	if found {
+		resolver = owner.resolver
 	}
 
-	// fmt.Println("Resolving ", itemType)
-	// defer fmt.Println("Resolve complete for ", itemType)
+	return func(key ItemKey, item interface{}, deps []ItemKey) {
+		d.observe(resolver)
+		d.setResolvedItem(key, item, deps)
+	}
+}
 
-	d.acquireResolveLock(itemType)
-	defer d.releaseResolveLock(itemType)
+// chainedDiscovery is implemented by discoveries that can continue the
+// resolution chain of a super discovery
+type chainedDiscovery interface {
+	_getTypedItem(ctx context.Context, key ItemKey, options ResolveOptions, parent *resolution) (interface{}, error)
+}
 
-	if checkBack != nil {
-		if item, ok := checkBack(itemType); ok {
-			return item, nil
+// getBaseItem gets an item from the base discovery as part of the resolution
+// chain of parent
+func (d *ItemDiscovery) getBaseItem(ctx context.Context, key ItemKey, options ResolveOptions, parent *resolution) (interface{}, error) {
+	if chained, ok := d.baseDiscovery.(chainedDiscovery); ok {
+		return chained._getTypedItem(ctx, key, options, parent)
+	}
+
+	return d.baseDiscovery.GetKeyedItemWithOptionsContext(ctx, key, options)
+}
+
+// mappingFinder is implemented by discoveries that can locate the mapping
+// for an item across their base discoveries
+type mappingFinder interface {
+	findMapping(key ItemKey) (ResolverMapping, *ItemDiscovery, bool)
+}
+
+// findMapping returns the mapping for key and the discovery that owns it,
+// searching the resolver of d first, followed by the base discoveries
+//
+//	Notes
+//		If the resolver of d is shared with a base discovery, the mapping is
+//		owned by the deepest discovery that uses the resolver, unless a
+//		discovery in between has its own mapping for key, or the base cannot
+//		resolve the item on behalf of d (see inherits)
+func (d *ItemDiscovery) findMapping(key ItemKey) (ResolverMapping, *ItemDiscovery, bool) {
+	if d.resolver != nil {
+		if mapping, ok := d.resolver.GetKeyedMapping(key); ok {
+			if d.sharedResolver {
+				if finder, ok := d.baseDiscovery.(mappingFinder); ok {
+					if baseMapping, owner, ok := finder.findMapping(key); ok && (owner.resolver == d.resolver) && d.inherits(baseMapping, owner) {
+						return baseMapping, owner, true
+					}
+				}
+			}
+
+			return mapping, d, true
 		}
 	}
 
-	item, err := d.resolver.ResolveItem(d, itemType)
+	if finder, ok := d.baseDiscovery.(mappingFinder); ok {
+		return finder.findMapping(key)
+	}
+
+	return ResolverMapping{}, nil, false
+}
 
-	if (item != nil) && (setItem != nil) {
-		setItem(itemType, item)
+// inherits returns true if the item of mapping can be resolved by the base
+// discovery owner on behalf of d
+//
+//	Notes
+//		The Creator of a mapping may depend on items that were added to d
+//		(e.g. per request) and that owner cannot see. Singletons are always
+//		resolved by owner. Other mappings are resolved by owner only if they
+//		declare their Dependencies, and owner resolves every one of them
+//		without items (or mappings) of the discoveries in between
+func (d *ItemDiscovery) inherits(mapping ResolverMapping, owner *ItemDiscovery) bool {
+	if mapping.Lifetime == LtSingleton {
+		return true
 	}
 
-	return item, err
+	if len(mapping.Dependencies) == 0 {
+		return false
+	}
+
+	for _, dep := range mapping.Dependencies {
+		if !d.leaves(dep, owner) {
+			return false
+		}
+	}
+
+	return true
 }
 
-func (d *ItemDiscovery) isResolving(itemType reflect.Type) bool {
-	for e := d.activeResolvers.Front(); e != nil; e = e.Next() {
-		if e.Value.(reflect.Type) == itemType {
+// leaves returns true if neither d nor the discoveries between d and its
+// base discovery owner have their own item or mapping for key, and owner can
+// provide the item
+func (d *ItemDiscovery) leaves(key ItemKey, owner *ItemDiscovery) bool {
+	for layer := d; layer != owner; {
+		if layer.hasAddedItem(key) {
+			return false
+		}
+
+		if (layer.resolver != nil) && (layer.resolver != owner.resolver) {
+			if _, ok := layer.resolver.GetKeyedMapping(key); ok {
+				return false
+			}
+		}
+
+		base, ok := layer.baseDiscovery.(*ItemDiscovery)
+		if !ok {
+			return false
+		}
+		layer = base
+	}
+
+	if _, _, ok := owner.findMapping(key); ok {
+		return true
+	}
+
+	for layer := owner; layer != nil; {
+		if _, ok := layer.getTypedItem(key); ok {
 			return true
 		}
+
+		base, ok := layer.baseDiscovery.(*ItemDiscovery)
+		if !ok {
+			return (layer.baseDiscovery != nil) && layer.baseDiscovery.HasKeyedItem(key)
+		}
+		layer = base
 	}
 
 	return false
 }
 
-func (d *ItemDiscovery) removeActiveResolver(itemType reflect.Type) {
-	for e := d.activeResolvers.Front(); e != nil; e = e.Next() {
-		if e.Value == itemType {
-			d.activeResolvers.Remove(e)
-			break
-		}
+// hasAddedItem returns true if an item was added to d for key, as opposed to
+// resolved and cached by d
+func (d *ItemDiscovery) hasAddedItem(key ItemKey) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	_, ok := d.sources[key]
+	return ok
+}
+
+// resolverUser is implemented by discoveries that can report whether a
+// resolver is used by them or by their base discoveries
+type resolverUser interface {
+	usesResolver(resolver ItemResolver) bool
+}
+
+// usesResolver returns true if resolver is the resolver of d, or of one of
+// its base discoveries
+func (d *ItemDiscovery) usesResolver(resolver ItemResolver) bool {
+	return (d.resolver == resolver) || sharesResolver(d.baseDiscovery, resolver)
+}
+
+// sharesResolver returns true if resolver is used by baseD, or by one of its
+// base discoveries
+func sharesResolver(baseD Discovery, resolver ItemResolver) bool {
+	if user, ok := baseD.(resolverUser); ok {
+		return user.usesResolver(resolver)
 	}
+
+	return false
 }
 
-func (d *ItemDiscovery) acquireResolveLock(itemType reflect.Type) {
-	var resLock *sync.Mutex
+type resolveFunc func(d Discovery) (interface{}, error)
+type resolveCheckBack func(key ItemKey) (interface{}, bool)
+type resolveSetItem func(key ItemKey, item interface{}, deps []ItemKey)
 
-	d.resolveLock.Lock()
+func (d *ItemDiscovery) resolveItem(ctx context.Context, key ItemKey, resolve resolveFunc, parent *resolution, checkBack resolveCheckBack, setItem resolveSetItem) (interface{}, error) {
+	if d.resolver == nil {
+		return nil, nil
+	}
+
+	// fmt.Println("Resolving ", key)
+	// defer fmt.Println("Resolve complete for ", key)
+
+	if err := ctx.Err(); err != nil {
+		return nil, newResolveError(d.errorContext(parent, key), key, err, "")
+	}
 
-	defer func() {
-		d.resolveLock.Unlock()
-		if resLock != nil {
-			resLock.Lock()
+	r := newResolution(ctx, d, key, parent)
+
+	// instances are created for the exclusive use of the caller, so only
+	// items that are cached are shared with concurrent callers
+	if setItem == nil {
+		if path := r.cyclePath(); path != nil {
+			return nil, newCircularDependencyError(ErrorContext{Path: path, Layer: d.layer()}, key)
 		}
-	}()
 
-	if d.isResolving(itemType) {
-		err := ErrCircularResolveDependency.Instance(itemType)
-		panic(err)
+		return d.create(r, resolve, nil)
 	}
 
-	d.activeResolvers.PushBack(itemType)
-	defer d.removeActiveResolver(itemType)
+	var f *flight
+	var err error
+	for {
+		var holder bool
+		if f, holder, err = d.joinFlight(r); err != nil {
+			if !stderrors.Is(err, ErrCircularDependency) {
+				err = newResolveError(errorContext(r, key), key, err, "")
+			}
+			return nil, err
+		}
 
-	var ok bool
+		if holder {
+			break
+		}
 
-	// note the lock is taken deferred
-	if resLock, ok = d.resolveLocks[itemType]; !ok {
-		resLock = &sync.Mutex{}
-		d.resolveLocks[itemType] = resLock
+		// the context of the holder is not the context of r, so r resolves
+		// the item itself rather than failing because the holder gave up
+		if !isContextError(f.err) || (ctx.Err() != nil) {
+			return f.item, f.err
+		}
 	}
+
+	// panics are recovered by create, so the flight always lands and the
+	// resolution is always completed
+	var item interface{}
+	defer func() { d.landFlight(f, item, err) }()
+
+	// the item may have been cached by a flight that landed before f started
+	if checkBack != nil {
+		var ok bool
+		if item, ok = checkBack(key); ok {
+			return item, nil
+		}
+	}
+
+	item, err = d.create(r, resolve, setItem)
+
+	return item, err
+}
+
+// isContextError returns true if err is the error of a context that is done
+func isContextError(err error) bool {
+	return stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded)
 }
 
-func (d *ItemDiscovery) releaseResolveLock(itemType reflect.Type) {
-	var resLock *sync.Mutex
+// create creates the item of r, and caches it via setItem (if specified)
+func (d *ItemDiscovery) create(r *resolution, resolve resolveFunc, setItem resolveSetItem) (interface{}, error) {
+	item, err := r.create(resolve)
+	deps := r.complete()
 
-	d.resolveLock.Lock()
+	if item != nil {
+		d.recordDependencies(r.key, deps)
 
-	defer func() {
-		d.resolveLock.Unlock()
-		if resLock != nil {
-			resLock.Unlock()
+		if setItem != nil {
+			setItem(r.key, item, deps)
+		} else {
+			d.notify(ItemResolved, r.key, item)
 		}
-	}()
+	}
 
-	resLock, _ = d.resolveLocks[itemType]
+	return item, err
 }
@@ -23,11 +23,11 @@ func TestAddRemove(t *testing.T) {
 		t.Error(err)
 	}
 
-	if len(d.items) != 1 {
+	if len(d.items.values()) != 1 {
 		t.Error("Expecting discovery to have 1 item")
 	}
 
-	item, ok := d.items[reflect.TypeOf(s)]
+	item, ok := d.items.get(TypeKey(reflect.TypeOf(s)))
 
 	if !ok {
 		t.Error("Expecting items to contain s")
@@ -41,7 +41,7 @@ func TestAddRemove(t *testing.T) {
 
 	d.RemoveItem(reflect.TypeOf((*string)(nil)).Elem())
 
-	if len(d.items) != 0 {
+	if len(d.items.values()) != 0 {
 		t.Error("Expecting discovery to be empty")
 	}
 
@@ -51,7 +51,7 @@ func TestAddRemove(t *testing.T) {
 		t.Error("Expecting that adding string keyed as float64 would fail")
 	}
 
-	if len(d.items) != 0 {
+	if len(d.items.values()) != 0 {
 		t.Error("Expecting discovery to be empty")
 	}
 }
@@ -100,6 +100,110 @@ func TestDiscovery(t *testing.T) {
 	}
 }
 
+func TestNamedItems(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.AddMappingsVar(
+		ResolverMapping{
+			Type: MockServiceType,
+			Name: "primary",
+			Creator: func(d Discovery) (interface{}, error) {
+				return &MockService{field: 1}, nil
+			},
+		},
+		ResolverMapping{
+			Type: MockServiceType,
+			Name: "replica",
+			Creator: func(d Discovery) (interface{}, error) {
+				return &MockService{field: 2}, nil
+			},
+		})
+
+	d := NewItemDiscovery(resolver)
+
+	primary, err := d.GetKeyedItem(NamedKey(MockServiceType, "primary"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, primary.(*MockService).field)
+
+	replica, err := d.GetKeyedItem(NamedKey(MockServiceType, "replica"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, replica.(*MockService).field)
+
+	// the unnamed item is distinct from the named items
+	assert.False(t, d.HasItem(MockServiceType))
+	_, err = d.GetItem(MockServiceType)
+	assert.Error(t, err)
+
+	assert.NoError(t, d.AddKeyedItem(NamedKey(MockServiceType, "other"), &MockService{field: 3}))
+	assert.True(t, d.HasKeyedItem(NamedKey(MockServiceType, "other")))
+	assert.False(t, d.HasItem(MockServiceType))
+
+	d.RemoveKeyedItem(NamedKey(MockServiceType, "other"))
+	assert.False(t, d.HasKeyedItem(NamedKey(MockServiceType, "other")))
+
+	// named items fall through to the base discovery
+	superD := NewItemDiscoveryWithBase(d, nil)
+	item, err := superD.GetKeyedItem(NamedKey(MockServiceType, "replica"))
+	assert.NoError(t, err)
+	assert.Same(t, replica, item)
+}
+
+func TestLifetimes(t *testing.T) {
+	newMapping := func(name string, lifetime Lifetime) ResolverMapping {
+		return ResolverMapping{
+			Type:     MockServiceType,
+			Name:     name,
+			Lifetime: lifetime,
+			Creator: func(d Discovery) (interface{}, error) {
+				return &MockService{}, nil
+			},
+		}
+	}
+
+	resolver := NewBaseItemResolver()
+	resolver.AddMappingsVar(
+		newMapping("singleton", LtSingleton),
+		newMapping("transient", LtTransient),
+		newMapping("scoped", LtScoped))
+
+	d := NewItemDiscovery(resolver)
+	superD := NewItemDiscoveryWithBase(d, nil)
+
+	singleton := NamedKey(MockServiceType, "singleton")
+	transient := NamedKey(MockServiceType, "transient")
+	scoped := NamedKey(MockServiceType, "scoped")
+
+	// singletons are shared across discoveries and cannot be instanced
+	item1 := d.GetRequiredKeyedItem(singleton)
+	item2 := superD.GetRequiredKeyedItem(singleton)
+	assert.Same(t, item1, item2)
+
+	_, err := d.GetKeyedItemWithOptions(singleton, RoInstanceItem)
+	assert.Error(t, err)
+
+	// transients are always new, regardless of the options
+	item1 = d.GetRequiredKeyedItem(transient)
+	item2 = d.GetRequiredKeyedItem(transient)
+	assert.NotSame(t, item1, item2)
+	assert.False(t, d.HasKeyedItem(transient))
+
+	_, err = d.GetKeyedItemWithOptions(transient, RoDontResolve)
+	assert.Error(t, err)
+
+	item1 = superD.GetRequiredKeyedItem(transient)
+	assert.NotNil(t, item1)
+	assert.False(t, superD.HasKeyedItem(transient))
+
+	// scoped items are shared within a discovery, but not across discoveries
+	item1 = d.GetRequiredKeyedItem(scoped)
+	item2 = superD.GetRequiredKeyedItem(scoped)
+	assert.NotSame(t, item1, item2)
+	assert.Same(t, item2, superD.GetRequiredKeyedItem(scoped))
+	assert.True(t, superD.HasKeyedItem(scoped))
+
+	_, err = superD.GetKeyedItemWithOptions(scoped, RoInstanceItem)
+	assert.Error(t, err)
+}
+
 func TestItemRequiredPanics(t *testing.T) {
 	defer func() {
 		if r := recover(); r == nil {
@@ -150,7 +254,7 @@ func MapHelper(aMap map[reflect.Type]ResolverMapping, mapping ResolverMapping) {
 	aMap[mapping.Type] = mapping
 }
 
-func (r *MockResolver) GetItem(d Discovery, itemType reflect.Type) (interface{}, error) {
+func (r *MockResolver) ResolveItem(d Discovery, itemType reflect.Type) (interface{}, error) {
 	creator, ok := r.mappings[itemType]
 	if !ok {
 		return nil, errors.New("Normally this is not an error, but we are testing")
@@ -159,6 +263,27 @@ func (r *MockResolver) GetItem(d Discovery, itemType reflect.Type) (interface{},
 	return creator.Creator(d)
 }
 
+func (r *MockResolver) ResolveKeyedItem(d Discovery, key ItemKey) (interface{}, error) {
+	if key.IsNamed() {
+		return nil, nil
+	}
+
+	return r.ResolveItem(d, key.Type)
+}
+
+func (r *MockResolver) GetKeyedMapping(key ItemKey) (ResolverMapping, bool) {
+	if key.IsNamed() {
+		return ResolverMapping{}, false
+	}
+
+	mapping, ok := r.mappings[key.Type]
+	return mapping, ok
+}
+
+func (r *MockResolver) ResolveMapping(d Discovery, mapping ResolverMapping) (interface{}, error) {
+	return mapping.Creator(d)
+}
+
 func (r *MockResolver) AddMapping(mapping ResolverMapping) {
 
 }
@@ -170,3 +295,83 @@ func (r *MockResolver) AddMappings(mapping []ResolverMapping) {
 func (r *MockResolver) AddMappingsVar(mappings ...ResolverMapping) {
 
 }
+
+func (r *MockResolver) RemoveMapping(key ItemKey, options MappingOptions) bool {
+	return false
+}
+
+func (r *MockResolver) ReplaceMapping(mapping ResolverMapping, options MappingOptions) bool {
+	return false
+}
+
+type otherService struct {
+	field int
+}
+
+func TestResolvedItemsAreTypeChecked(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.AddMappingsVar(
+		ResolverMapping{
+			Type: MockServiceType,
+			Creator: func(d Discovery) (interface{}, error) {
+				return "not a service", nil
+			},
+		},
+		ResolverMapping{
+			Type: TypeOf[MockService](),
+			Creator: func(d Discovery) (interface{}, error) {
+				return otherService{field: 1}, nil
+			},
+		})
+
+	d := NewItemDiscovery(resolver)
+
+	_, err := d.GetItem(MockServiceType)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), typeName(MockServiceType))
+
+	// otherService is convertible, but not assignable, to MockService
+	_, err = d.GetItem(TypeOf[MockService]())
+	assert.NoError(t, err)
+
+	// the generic helpers report it rather than panic
+	_, err = Get[MockService](d)
+	assert.ErrorIs(t, err, ErrNotItemType)
+	assert.Contains(t, err.Error(), typeName(TypeOf[MockService]()))
+	assert.PanicsWithError(t, err.Error(), func() { MustGet[MockService](d) })
+
+	resolver.SetStrictTypes(true)
+	_, err = d.GetItemWithOptions(TypeOf[MockService](), RoInstanceItem)
+	assert.Error(t, err)
+
+	d.SetStrictTypes(true)
+	assert.Error(t, d.AddItem(TypeOf[MockService](), otherService{}))
+	assert.Error(t, d.AddItem(MockServiceType, nil))
+}
+
+func TestWrappedItemsAreTypeChecked(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.AddMapping(ResolverMapping{
+		Type: testItemType,
+		Creator: func(d Discovery) (interface{}, error) {
+			return &testItemImpl{}, nil
+		},
+	})
+	resolver.AddMapping(ResolverMapping{
+		Type: MockServiceType,
+		Creator: func(d Discovery) (interface{}, error) {
+			return &MockService{}, nil
+		},
+	})
+	resolver.AddAOMapping(AOResolverMapping{
+		Type: MockServiceType,
+		Creator: func(d Discovery, item interface{}) (interface{}, error) {
+			// AO creators can acquire items from the same resolver
+			return d.GetItem(testItemType)
+		},
+	})
+
+	_, err := NewItemDiscovery(resolver).GetItem(MockServiceType)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ao mapping")
+}
@@ -0,0 +1,373 @@
+// Package discoverytest provides isolated discoveries, overrides and
+// assertions for tests of code that uses discovery
+package discoverytest
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gotomgo/discovery"
+)
+
+// Discovery is an isolated discovery for a single test
+//
+//	Notes
+//		Discovery records the items that the test acquires through it, even if
+//		they were cached by a base discovery before the test started, and the
+//		items that are created for them (by Discovery or its base
+//		discoveries) while the test runs (see AssertResolved). Dependencies
+//		that a base discovery cached before the test started are not
+//		recorded unless they are acquired through Discovery. Items that are
+//		added (or overridden) are not resolved, and are not recorded
+//
+//		When the test completes, the recording stops and the items owned by
+//		Discovery are shut down
+type Discovery struct {
+	*discovery.ItemDiscovery
+
+	t testing.TB
+
+	lock     sync.Mutex
+	resolved []discovery.ItemKey
+}
+
+// New creates an isolated Discovery for t
+//
+//	Params
+//	  t - the test
+//	  resolver - optional ItemResolver
+func New(t testing.TB, resolver discovery.ItemResolver) *Discovery {
+	return newDiscovery(t, discovery.NewItemDiscovery(resolver))
+}
+
+// NewWithBase creates a Discovery for t that overrides base
+//
+//	Params
+//	  t - the test
+//	  base - the discovery being overridden, typically production wiring
+//	  resolver - optional ItemResolver
+//
+//	Notes
+//		This is the test equivalent of discovery.NewDiscoveryWithBase. Items
+//		and mappings overridden in Discovery are used by everything resolved
+//		by Discovery, but items that base resolves (and caches) for itself are
+//		created with the wiring of base. Use NewFromWiring to override the
+//		dependencies of every item
+func NewWithBase(t testing.TB, base discovery.Discovery, resolver discovery.ItemResolver) *Discovery {
+	return newDiscovery(t, discovery.NewItemDiscoveryWithBase(base, resolver))
+}
+
+// NewSuper creates a Discovery for t that overrides the default discovery
+//
+//	Params
+//	  t - the test
+//	  resolver - optional ItemResolver
+//
+//	Notes
+//		This is the test equivalent of discovery.CreateSuperDiscovery, and
+//		panics if the default discovery has not been set
+func NewSuper(t testing.TB, resolver discovery.ItemResolver) *Discovery {
+	return NewWithBase(t, discovery.GetDefaultDiscoveryOrPanic(), resolver)
+}
+
+// NewFromWiring creates an isolated Discovery for t with a copy of the
+// mappings of wiring
+//
+//	Params
+//	  t - the test
+//	  wiring - the resolver with the production mappings
+//
+//	Notes
+//		Unlike NewWithBase, nothing is shared with production: every item is
+//		resolved (and cached) by Discovery, so overridden mappings are used by
+//		every item that depends on them
+func NewFromWiring(t testing.TB, wiring *discovery.BaseItemResolver) *Discovery {
+	resolver := discovery.NewBaseItemResolver()
+	resolver.AddMappings(wiring.Mappings())
+	resolver.AddAOMappings(wiring.AOMappings())
+
+	return New(t, resolver)
+}
+
+func newDiscovery(t testing.TB, d *discovery.ItemDiscovery) *Discovery {
+	td := &Discovery{ItemDiscovery: d, t: t}
+
+	unsubscribe := d.Subscribe(nil, func(event discovery.ItemEvent) {
+		if event.Kind == discovery.ItemResolved {
+			td.record(event.Key)
+		}
+	})
+
+	t.Cleanup(func() {
+		unsubscribe()
+
+		if err := d.Shutdown(context.Background()); err != nil {
+			t.Errorf("discoverytest: shutdown failed: %s", err)
+		}
+	})
+
+	return td
+}
+
+// record records that the item for key was resolved, unless it already was
+func (d *Discovery) record(key discovery.ItemKey) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, resolved := range d.resolved {
+		if resolved == key {
+			return
+		}
+	}
+
+	d.resolved = append(d.resolved, key)
+}
+
+// acquire acquires the item for key, and records it if it was acquired
+func (d *Discovery) acquire(ctx context.Context, key discovery.ItemKey, options discovery.ResolveOptions) (interface{}, error) {
+	item, err := d.ItemDiscovery.GetKeyedItemWithOptionsContext(ctx, key, options)
+	if err == nil {
+		d.record(key)
+	}
+
+	return item, err
+}
+
+func (d *Discovery) GetItem(itemType reflect.Type) (interface{}, error) {
+	return d.acquire(context.Background(), discovery.TypeKey(itemType), discovery.RoNone)
+}
+
+func (d *Discovery) GetRequiredItem(itemType reflect.Type) interface{} {
+	return d.GetRequiredKeyedItem(discovery.TypeKey(itemType))
+}
+
+func (d *Discovery) GetItemWithOptions(itemType reflect.Type, options discovery.ResolveOptions) (interface{}, error) {
+	return d.acquire(context.Background(), discovery.TypeKey(itemType), options)
+}
+
+func (d *Discovery) GetRequiredItemWithOptions(itemType reflect.Type, options discovery.ResolveOptions) (interface{}, error) {
+	return d.acquire(context.Background(), discovery.TypeKey(itemType), options)
+}
+
+func (d *Discovery) GetKeyedItem(key discovery.ItemKey) (interface{}, error) {
+	return d.acquire(context.Background(), key, discovery.RoNone)
+}
+
+func (d *Discovery) GetRequiredKeyedItem(key discovery.ItemKey) interface{} {
+	item, err := d.acquire(context.Background(), key, discovery.RoNone)
+	if err != nil {
+		panic(err)
+	}
+
+	return item
+}
+
+func (d *Discovery) GetKeyedItemWithOptions(key discovery.ItemKey, options discovery.ResolveOptions) (interface{}, error) {
+	return d.acquire(context.Background(), key, options)
+}
+
+func (d *Discovery) GetItemContext(ctx context.Context, itemType reflect.Type) (interface{}, error) {
+	return d.acquire(ctx, discovery.TypeKey(itemType), discovery.RoNone)
+}
+
+func (d *Discovery) GetItemWithOptionsContext(ctx context.Context, itemType reflect.Type, options discovery.ResolveOptions) (interface{}, error) {
+	return d.acquire(ctx, discovery.TypeKey(itemType), options)
+}
+
+func (d *Discovery) GetKeyedItemWithOptionsContext(ctx context.Context, key discovery.ItemKey, options discovery.ResolveOptions) (interface{}, error) {
+	return d.acquire(ctx, key, options)
+}
+
+// Override adds item as the item for itemType, and fails the test if the
+// item cannot be added
+func (d *Discovery) Override(itemType reflect.Type, item interface{}) *Discovery {
+	d.t.Helper()
+
+	return d.OverrideKeyed(discovery.TypeKey(itemType), item)
+}
+
+// OverrideKeyed adds item as the item for key, and fails the test if the
+// item cannot be added
+func (d *Discovery) OverrideKeyed(key discovery.ItemKey, item interface{}) *Discovery {
+	d.t.Helper()
+
+	if err := d.AddKeyedItem(key, item); err != nil {
+		d.t.Fatalf("discoverytest: override of %s failed: %s", key, err)
+	}
+
+	return d
+}
+
+// OverrideMapping adds mapping to the resolver of Discovery
+//
+//	Notes
+//		The mapping is found before any mapping of a base discovery for the
+//		same item
+func (d *Discovery) OverrideMapping(mapping discovery.ResolverMapping) *Discovery {
+	d.GetResolver().AddMapping(mapping)
+
+	return d
+}
+
+// Override adds fake as the item for T, and fails the test if the item
+// cannot be added
+func Override[T any](d *Discovery, fake T) *Discovery {
+	d.t.Helper()
+
+	if err := discovery.Set(d, fake); err != nil {
+		d.t.Fatalf("discoverytest: override of %s failed: %s", discovery.TypeKey(discovery.TypeOf[T]()), err)
+	}
+
+	return d
+}
+
+// OverrideFunc adds creator as the mapping for T to the resolver of
+// Discovery, so that fakes can depend on other items
+func OverrideFunc[T any](d *Discovery, creator func(d discovery.Discovery) (T, error)) *Discovery {
+	d.t.Helper()
+
+	if err := discovery.Provide(d, creator); err != nil {
+		d.t.Fatalf("discoverytest: override of %s failed: %s", discovery.TypeKey(discovery.TypeOf[T]()), err)
+	}
+
+	return d
+}
+
+// AsDefault calls fn with Discovery as the default discovery (see
+// discovery.WithDefaultDiscovery)
+//
+//	Notes
+//		The default discovery is shared by the process, so AsDefault of tests
+//		that run in parallel is called one at a time. Calls of the test that
+//		owns the default discovery, and of its subtests, nest instead of
+//		waiting
+func (d *Discovery) AsDefault(fn func()) {
+	defaultOwner.acquire(d.t.Name())
+	defer defaultOwner.release()
+
+	discovery.WithDefaultDiscovery(d, fn)
+}
+
+// scopeOwner tracks the test that owns the default discovery
+type scopeOwner struct {
+	lock  sync.Mutex
+	cond  *sync.Cond
+	name  string
+	depth int
+}
+
+var defaultOwner = newScopeOwner()
+
+func newScopeOwner() *scopeOwner {
+	owner := &scopeOwner{}
+	owner.cond = sync.NewCond(&owner.lock)
+	return owner
+}
+
+// acquire waits until the default discovery is not owned, or is owned by
+// test or one of its parent tests
+func (o *scopeOwner) acquire(test string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	for (o.depth > 0) && (test != o.name) && !strings.HasPrefix(test, o.name+"/") {
+		o.cond.Wait()
+	}
+
+	if o.depth == 0 {
+		o.name = test
+	}
+	o.depth++
+}
+
+func (o *scopeOwner) release() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.depth--; o.depth == 0 {
+		o.name = ""
+		o.cond.Broadcast()
+	}
+}
+
+// Resolved returns the keys of the items resolved so far, in the order they
+// were first resolved
+func (d *Discovery) Resolved() []discovery.ItemKey {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return append([]discovery.ItemKey(nil), d.resolved...)
+}
+
+// WasResolved returns true if the item for key was resolved
+func (d *Discovery) WasResolved(key discovery.ItemKey) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, resolved := range d.resolved {
+		if resolved == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AssertResolved fails the test unless every item type was resolved, and
+// returns true if they were
+func (d *Discovery) AssertResolved(itemTypes ...reflect.Type) bool {
+	d.t.Helper()
+
+	ok := true
+	for _, itemType := range itemTypes {
+		if key := discovery.TypeKey(itemType); !d.WasResolved(key) {
+			d.t.Errorf("discoverytest: expected %s to be resolved, resolved: %v", key, d.Resolved())
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+// AssertNotResolved fails the test if any item type was resolved, and
+// returns true if none were
+func (d *Discovery) AssertNotResolved(itemTypes ...reflect.Type) bool {
+	d.t.Helper()
+
+	ok := true
+	for _, itemType := range itemTypes {
+		if key := discovery.TypeKey(itemType); d.WasResolved(key) {
+			d.t.Errorf("discoverytest: expected %s not to be resolved", key)
+			ok = false
+		}
+	}
+
+	return ok
+}
+
+// AssertResolvedKey fails the test unless the item for key was resolved
+func (d *Discovery) AssertResolvedKey(key discovery.ItemKey) bool {
+	d.t.Helper()
+
+	if !d.WasResolved(key) {
+		d.t.Errorf("discoverytest: expected %s to be resolved, resolved: %v", key, d.Resolved())
+		return false
+	}
+
+	return true
+}
+
+// AssertNotResolvedKey fails the test if the item for key was resolved
+func (d *Discovery) AssertNotResolvedKey(key discovery.ItemKey) bool {
+	d.t.Helper()
+
+	if d.WasResolved(key) {
+		d.t.Errorf("discoverytest: expected %s not to be resolved", key)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,206 @@
+package discoverytest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gotomgo/discovery"
+	"github.com/stretchr/testify/assert"
+)
+
+type store interface {
+	Load() string
+}
+
+type service interface {
+	Run() string
+}
+
+type realStore struct{}
+
+func (realStore) Load() string { return "real" }
+
+type fakeStore struct{}
+
+func (fakeStore) Load() string { return "fake" }
+
+type storeService struct {
+	store store
+}
+
+func (s *storeService) Run() string { return s.store.Load() }
+
+var storeType = discovery.TypeOf[store]()
+var serviceType = discovery.TypeOf[service]()
+
+// wiring returns the production wiring used by the tests
+func wiring() *discovery.BaseItemResolver {
+	resolver := discovery.NewBaseItemResolver()
+	resolver.AddMappingsVar(
+		discovery.ResolverMapping{
+			Type: storeType,
+			Creator: func(d discovery.Discovery) (interface{}, error) {
+				return realStore{}, nil
+			}},
+		discovery.ResolverMapping{
+			Type: serviceType,
+			Creator: func(d discovery.Discovery) (interface{}, error) {
+				s, err := discovery.Get[store](d)
+				if err != nil {
+					return nil, err
+				}
+				return &storeService{store: s}, nil
+			}})
+
+	return resolver
+}
+
+// recordingTB records failures instead of failing the test
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestIsolatedDiscovery(t *testing.T) {
+	d := New(t, wiring())
+
+	s, err := discovery.Get[service](d)
+	assert.NoError(t, err)
+	assert.Equal(t, "real", s.Run())
+
+	d.AssertResolved(serviceType, storeType)
+	assert.Equal(t, []discovery.ItemKey{discovery.TypeKey(storeType), discovery.TypeKey(serviceType)}, d.Resolved())
+}
+
+func TestOverrides(t *testing.T) {
+	d := NewFromWiring(t, wiring())
+	Override[store](d, fakeStore{})
+
+	s, err := discovery.Get[service](d)
+	assert.NoError(t, err)
+	assert.Equal(t, "fake", s.Run())
+
+	// overridden items are added, not resolved
+	d.AssertResolved(serviceType)
+	d.AssertNotResolved(storeType)
+
+	d = NewFromWiring(t, wiring())
+	OverrideFunc(d, func(d discovery.Discovery) (store, error) {
+		return fakeStore{}, nil
+	})
+
+	s, err = discovery.Get[service](d)
+	assert.NoError(t, err)
+	assert.Equal(t, "fake", s.Run())
+	d.AssertResolved(serviceType, storeType)
+}
+
+func TestOverrideBase(t *testing.T) {
+	base := discovery.NewItemDiscovery(wiring())
+
+	d := NewWithBase(t, base, nil)
+	d.Override(storeType, fakeStore{})
+
+	s, err := discovery.Get[store](d)
+	assert.NoError(t, err)
+	assert.Equal(t, "fake", s.Load())
+
+	// the base discovery is not affected by the override
+	s, err = discovery.Get[store](base)
+	assert.NoError(t, err)
+	assert.Equal(t, "real", s.Load())
+
+	// items resolved by the base discovery are recorded
+	_, err = discovery.Get[service](d)
+	assert.NoError(t, err)
+	d.AssertResolved(serviceType)
+}
+
+func TestRecordingSharedBase(t *testing.T) {
+	base := discovery.NewItemDiscovery(wiring())
+
+	// the base caches the items for the first test, and the second test
+	// acquires them from the cache
+	for i := 0; i < 2; i++ {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			d := NewWithBase(t, base, nil)
+
+			_, err := discovery.Get[service](d)
+			assert.NoError(t, err)
+			d.AssertResolved(serviceType)
+
+			// dependencies cached before the test are not acquired by it
+			if i > 0 {
+				d.AssertNotResolved(storeType)
+			}
+		})
+	}
+}
+
+func TestAssertionsFail(t *testing.T) {
+	tb := &recordingTB{TB: t}
+	d := New(tb, wiring())
+
+	assert.False(t, d.AssertResolved(storeType))
+	assert.Len(t, tb.errors, 1)
+
+	_, err := discovery.Get[store](d)
+	assert.NoError(t, err)
+
+	assert.False(t, d.AssertNotResolved(storeType))
+	assert.False(t, d.AssertNotResolvedKey(discovery.TypeKey(storeType)))
+	assert.False(t, d.AssertResolvedKey(discovery.NamedKey(storeType, "other")))
+	assert.Len(t, tb.errors, 4)
+}
+
+func TestAsDefault(t *testing.T) {
+	t.Parallel()
+
+	d := New(t, wiring())
+	d.AsDefault(func() {
+		s, err := discovery.Get[service](nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "real", s.Run())
+
+		// subtests of the owner nest
+		t.Run("nested", func(t *testing.T) {
+			fake := NewSuper(t, nil)
+			Override[store](fake, fakeStore{})
+
+			fake.AsDefault(func() {
+				s, err := discovery.Get[store](nil)
+				assert.NoError(t, err)
+				assert.Equal(t, "fake", s.Load())
+			})
+		})
+
+		assert.Equal(t, d, discovery.GetDefaultDiscovery())
+	})
+
+	d.AssertResolved(serviceType, storeType)
+}
+
+func TestAsDefaultParallel(t *testing.T) {
+	for i := 0; i < 8; i++ {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			t.Parallel()
+
+			d := New(t, wiring())
+			d.AsDefault(func() {
+				assert.Equal(t, d, discovery.GetDefaultDiscovery())
+
+				_, err := discovery.Get[store](nil)
+				assert.NoError(t, err)
+				assert.Equal(t, d, discovery.GetDefaultDiscovery())
+			})
+
+			d.AssertResolved(storeType)
+		})
+	}
+}
@@ -22,6 +22,55 @@ const (
 	// ErrCircularResolveDependencyID indicates a circular dependency between
 	// items
 	ErrCircularResolveDependencyID = "discovery/item/resolve/circular"
+
+	// ErrLifetimeConflictID indicates resolve options that conflict with the
+	// lifetime declared by the item's mapping
+	ErrLifetimeConflictID = "discovery/item/resolve/lifetime-conflict"
+
+	// ErrItemCloseFailedID indicates an owned item that failed to stop or
+	// close during shutdown
+	ErrItemCloseFailedID = "discovery/item/close/failed"
+
+	// ErrItemStartFailedID indicates an owned item that failed to start
+	ErrItemStartFailedID = "discovery/item/start/failed"
+
+	// ErrItemStopFailedID indicates a started item that failed to stop
+	ErrItemStopFailedID = "discovery/item/stop/failed"
+
+	// ErrInvalidInjectTargetID indicates an inject target that is not a
+	// pointer to a struct
+	ErrInvalidInjectTargetID = "discovery/inject/invalid-target"
+
+	// ErrInvalidInjectTagID indicates a malformed inject tag
+	ErrInvalidInjectTagID = "discovery/inject/invalid-tag"
+
+	// ErrFieldNotInjectedID indicates a field that could not be injected
+	ErrFieldNotInjectedID = "discovery/inject/field/failed"
+
+	// ErrInvalidConstructorID indicates a constructor that cannot be used as
+	// a mapping
+	ErrInvalidConstructorID = "discovery/mapping/invalid-constructor"
+
+	// ErrValidationFailedID indicates a problem found by Validate
+	ErrValidationFailedID = "discovery/validate/failed"
+
+	// ErrDuplicateRegistrationID indicates an item or mapping that was
+	// registered more than once (see ConflictPolicy)
+	ErrDuplicateRegistrationID = "discovery/registration/duplicate"
+
+	// ErrDiscoveryFrozenID indicates a change to a frozen discovery or
+	// resolver
+	ErrDiscoveryFrozenID = "discovery/frozen"
+
+	// ErrModuleCycleID indicates modules that require each other
+	ErrModuleCycleID = "discovery/module/circular"
+
+	// ErrModuleConflictID indicates a module that conflicts with a module
+	// that is already installed
+	ErrModuleConflictID = "discovery/module/conflict"
+
+	// ErrModuleInstallFailedID indicates a module that failed to install
+	ErrModuleInstallFailedID = "discovery/module/install/failed"
 )
 
 var (
@@ -45,7 +94,91 @@ var (
 
 	ErrCircularResolveDependency = errors.NewErrorTemplate(
 		ErrCircularResolveDependencyID,
-		"item type %s has a circular resolve dependency",
+		"item type %s has a circular resolve dependency: %s",
+		http.StatusInternalServerError,
+		false)
+
+	ErrLifetimeConflict = errors.NewErrorTemplate(
+		ErrLifetimeConflictID,
+		"item '%s' has a %s lifetime that conflicts with %s",
+		http.StatusInternalServerError,
+		false)
+
+	ErrItemCloseFailed = errors.NewErrorTemplate(
+		ErrItemCloseFailedID,
+		"item '%s' failed to close: %s",
+		http.StatusInternalServerError,
+		false)
+
+	ErrItemStartFailed = errors.NewErrorTemplate(
+		ErrItemStartFailedID,
+		"item '%s' failed to start: %s",
+		http.StatusInternalServerError,
+		false)
+
+	ErrItemStopFailed = errors.NewErrorTemplate(
+		ErrItemStopFailedID,
+		"item '%s' failed to stop: %s",
+		http.StatusInternalServerError,
+		false)
+
+	ErrInvalidInjectTarget = errors.NewErrorTemplate(
+		ErrInvalidInjectTargetID,
+		"inject target must be a pointer to a struct, not %s",
+		http.StatusInternalServerError,
+		false)
+
+	ErrInvalidInjectTag = errors.NewErrorTemplate(
+		ErrInvalidInjectTagID,
+		"invalid inject tag '%s'",
+		http.StatusInternalServerError,
+		false)
+
+	ErrFieldNotInjected = errors.NewErrorTemplate(
+		ErrFieldNotInjectedID,
+		"field %s.%s not injected: %s",
+		http.StatusInternalServerError,
+		false)
+
+	ErrInvalidConstructor = errors.NewErrorTemplate(
+		ErrInvalidConstructorID,
+		"invalid constructor %s: %s",
+		http.StatusInternalServerError,
+		false)
+
+	ErrValidationFailed = errors.NewErrorTemplate(
+		ErrValidationFailedID,
+		"validation failed: %s",
+		http.StatusInternalServerError,
+		false)
+
+	ErrDuplicateRegistration = errors.NewErrorTemplate(
+		ErrDuplicateRegistrationID,
+		"%s %s registered at %s is already registered at %s",
+		http.StatusInternalServerError,
+		false)
+
+	ErrDiscoveryFrozen = errors.NewErrorTemplate(
+		ErrDiscoveryFrozenID,
+		"cannot %s %s: discovery is frozen",
+		http.StatusInternalServerError,
+		false)
+
+	ErrModuleCycle = errors.NewErrorTemplate(
+		ErrModuleCycleID,
+		"module '%s' has a circular requirement: %s",
+		http.StatusInternalServerError,
+		false)
+
+	ErrModuleConflict = errors.NewErrorTemplate(
+		ErrModuleConflictID,
+		"module '%s' conflicts with module '%s': %s",
+		http.StatusInternalServerError,
+		false)
+
+	ErrModuleInstallFailed = errors.NewErrorTemplate(
+		ErrModuleInstallFailedID,
+		"module '%s' failed to install: %s",
 		http.StatusInternalServerError,
 		false)
 )
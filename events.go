@@ -0,0 +1,203 @@
+package discovery
+
+import (
+	"reflect"
+	"sync"
+)
+
+// ItemEventKind identifies what happened to an item
+type ItemEventKind int
+
+const (
+	// ItemAdded indicates an item was added via AddItem (or a variant)
+	ItemAdded ItemEventKind = iota
+	// ItemReplaced indicates an item was added that replaced an existing item
+	ItemReplaced
+	// ItemRemoved indicates an item was removed from discovery
+	ItemRemoved
+	// ItemResolved indicates an item was created by resolution
+	ItemResolved
+)
+
+// String returns the name of the event kind
+func (k ItemEventKind) String() string {
+	switch k {
+	case ItemAdded:
+		return "added"
+	case ItemReplaced:
+		return "replaced"
+	case ItemRemoved:
+		return "removed"
+	case ItemResolved:
+		return "resolved"
+	}
+
+	return "unknown"
+}
+
+// ItemEvent describes a change to an item of discovery
+//
+//	Notes
+//		Discovery is the discovery where the change occurred, which is a base
+//		discovery for events that are forwarded to a super discovery
+type ItemEvent struct {
+	Kind      ItemEventKind
+	Key       ItemKey
+	Item      interface{}
+	Discovery Discovery
+}
+
+// ItemListener is the signature for a function that receives item events
+type ItemListener func(event ItemEvent)
+
+// ItemNotifier provides the ability to subscribe to item events
+type ItemNotifier interface {
+	Subscribe(itemType reflect.Type, listener ItemListener) (unsubscribe func())
+}
+
+var _ ItemNotifier = &ItemDiscovery{}
+
+// subscription is an entry of ItemDiscovery.typeListeners
+type subscription struct {
+	itemType reflect.Type
+	listener ItemListener
+}
+
+// queuedEvent is an event waiting for delivery. Events forwarded from a base
+// discovery target the subscription that requested them, other events are
+// delivered to every subscription for the item type
+type queuedEvent struct {
+	event  ItemEvent
+	target *subscription
+}
+
+// Subscribe registers listener for the events of items of itemType,
+// including named items and events that occur in base discoveries
+//
+//	Notes
+//		Events are delivered in the order they occur, and never while
+//		discovery holds its item lock, so listeners are free to call back into
+//		discovery. Events that occur while listeners are being called are
+//		queued and delivered once the listeners return
+//
+//		A nil itemType subscribes to the events of every item type
+//
+//		The returned func removes the subscription. It is safe to call it more
+//		than once
+func (d *ItemDiscovery) Subscribe(itemType reflect.Type, listener ItemListener) (unsubscribe func()) {
+	sub := &subscription{itemType: itemType, listener: listener}
+
+	d.listenerLock.Lock()
+	e := d.typeListeners.PushBack(sub)
+	d.listenerLock.Unlock()
+
+	unsubscribeBase := func() {}
+	if notifier, ok := d.baseDiscovery.(ItemNotifier); ok {
+		unsubscribeBase = notifier.Subscribe(itemType, func(event ItemEvent) {
+			d.listenerLock.Lock()
+			d.events = append(d.events, queuedEvent{event: event, target: sub})
+			d.listenerLock.Unlock()
+
+			d.dispatchEvents()
+		})
+	}
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			unsubscribeBase()
+
+			d.listenerLock.Lock()
+			defer d.listenerLock.Unlock()
+			d.typeListeners.Remove(e)
+		})
+	}
+}
+
+// queueEvent queues an event for delivery
+//
+//	Notes
+//		Changes to items queue their event while holding d.lock, which is what
+//		guarantees that events are delivered in the order they occur. Delivery
+//		is done by dispatchEvents once d.lock is released
+func (d *ItemDiscovery) queueEvent(kind ItemEventKind, key ItemKey, item interface{}) {
+	d.listenerLock.Lock()
+	defer d.listenerLock.Unlock()
+
+	if d.typeListeners.Len() == 0 {
+		return
+	}
+
+	d.events = append(d.events, queuedEvent{
+		event: ItemEvent{Kind: kind, Key: key, Item: item, Discovery: d},
+	})
+}
+
+// notify queues and delivers an event
+func (d *ItemDiscovery) notify(kind ItemEventKind, key ItemKey, item interface{}) {
+	d.queueEvent(kind, key, item)
+	d.dispatchEvents()
+}
+
+// dispatchEvents delivers queued events, unless another goroutine is already
+// delivering them, in which case that goroutine delivers them in order
+func (d *ItemDiscovery) dispatchEvents() {
+	d.listenerLock.Lock()
+
+	if d.dispatching {
+		d.listenerLock.Unlock()
+		return
+	}
+
+	d.dispatching = true
+
+	// deliver takes the lock again before it returns, including when a
+	// listener panics, so dispatching is always reset under the lock
+	defer func() {
+		d.dispatching = false
+		d.listenerLock.Unlock()
+	}()
+
+	for len(d.events) > 0 {
+		pending := d.events[0]
+		d.events = d.events[1:]
+
+		d.deliver(pending.event, d.listenersFor(pending))
+	}
+}
+
+// deliver calls listeners with event while listenerLock is released.
+// listenerLock must be held, and is held again when deliver returns or panics
+//
+//	Notes
+//		A panic of a listener is propagated to the caller that changed the
+//		item. Events that are still queued are delivered by the next dispatch
+func (d *ItemDiscovery) deliver(event ItemEvent, listeners []ItemListener) {
+	d.listenerLock.Unlock()
+	defer d.listenerLock.Lock()
+
+	for _, listener := range listeners {
+		listener(event)
+	}
+}
+
+// listenersFor returns the listeners of a queued event, listenerLock must be
+// held
+func (d *ItemDiscovery) listenersFor(pending queuedEvent) []ItemListener {
+	var result []ItemListener
+
+	for e := d.typeListeners.Front(); e != nil; e = e.Next() {
+		sub := e.Value.(*subscription)
+
+		if pending.target != nil {
+			if sub == pending.target {
+				return []ItemListener{sub.listener}
+			}
+		} else if (sub.itemType == nil) || (sub.itemType == pending.event.Key.Type) {
+			result = append(result, sub.listener)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,92 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	var events []ItemEvent
+
+	d := NewItemDiscovery(mockResolver)
+	superD := NewItemDiscoveryWithBase(d, nil)
+
+	unsubscribe := superD.Subscribe(MockServiceType, func(event ItemEvent) {
+		events = append(events, event)
+	})
+
+	// resolved in the base discovery
+	item := superD.GetRequiredItem(MockServiceType)
+
+	assert.NoError(t, superD.AddItem(MockServiceType, &MockService{}))
+	assert.NoError(t, superD.AddItem(MockServiceType, &MockService{}))
+	superD.RemoveItem(MockServiceType)
+
+	// other types are not reported
+	assert.NoError(t, superD.AddItem(testItemType, &testItemImpl{}))
+
+	if assert.Len(t, events, 4) {
+		assert.Equal(t, ItemResolved, events[0].Kind)
+		assert.Same(t, item, events[0].Item)
+		assert.Equal(t, d, events[0].Discovery)
+
+		assert.Equal(t, ItemAdded, events[1].Kind)
+		assert.Equal(t, ItemReplaced, events[2].Kind)
+		assert.Equal(t, ItemRemoved, events[3].Kind)
+		assert.Equal(t, superD, events[3].Discovery)
+	}
+
+	unsubscribe()
+	unsubscribe()
+
+	assert.NoError(t, superD.AddItem(MockServiceType, &MockService{}))
+	d.RemoveItem(MockServiceType)
+	assert.Len(t, events, 4)
+	assert.Equal(t, 0, d.typeListeners.Len())
+}
+
+func TestSubscribeReentrant(t *testing.T) {
+	var kinds []ItemEventKind
+
+	d := NewItemDiscovery(nil)
+
+	d.Subscribe(MockServiceType, func(event ItemEvent) {
+		kinds = append(kinds, event.Kind)
+
+		// changes made by a listener are delivered after it returns
+		if event.Kind == ItemAdded {
+			d.RemoveItem(MockServiceType)
+			kinds = append(kinds, -1)
+		}
+	})
+
+	assert.NoError(t, d.AddItem(MockServiceType, &MockService{}))
+	assert.Equal(t, []ItemEventKind{ItemAdded, -1, ItemRemoved}, kinds)
+}
+
+func TestSubscribePanics(t *testing.T) {
+	var kinds []ItemEventKind
+
+	d := NewItemDiscovery(nil)
+
+	d.Subscribe(MockServiceType, func(event ItemEvent) {
+		if event.Kind == ItemAdded {
+			panic("listener panicked")
+		}
+	})
+	d.Subscribe(MockServiceType, func(event ItemEvent) {
+		kinds = append(kinds, event.Kind)
+	})
+
+	assert.PanicsWithValue(t, "listener panicked", func() {
+		_ = d.AddItem(MockServiceType, &MockService{})
+	})
+
+	// the item was added, and events are still delivered
+	assert.True(t, d.HasItem(MockServiceType))
+	assert.False(t, d.dispatching)
+
+	d.RemoveItem(MockServiceType)
+	assert.Equal(t, []ItemEventKind{ItemRemoved}, kinds)
+}
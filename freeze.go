@@ -0,0 +1,117 @@
+package discovery
+
+// FreezeOptions represents flag values used by FreezeWithOptions
+type FreezeOptions int
+
+const (
+	// FoNone represents no freeze options: discovery is sealed, and items
+	// that have not been resolved can no longer be resolved (and cached)
+	FoNone FreezeOptions = 0
+	// FoAllowCaching is used to indicate that items can still be resolved
+	// and cached by discovery, but not added or removed
+	FoAllowCaching FreezeOptions = 1 << 0
+)
+
+// freeze states of ItemDiscovery, ordered from least to most restrictive
+const (
+	notFrozen int32 = iota
+	frozenCaching
+	frozenSealed
+)
+
+// FrozenError is returned when a frozen discovery or resolver is changed
+//
+//	Notes
+//		Methods without an error result panic with the *FrozenError instead,
+//		each of them has a Try variant that returns it
+type FrozenError struct {
+	Op  string
+	Key ItemKey
+
+	template error
+}
+
+func newFrozenError(op string, key ItemKey) error {
+	return &FrozenError{Op: op, Key: key, template: ErrDiscoveryFrozen.Instance(op, key)}
+}
+
+func (e *FrozenError) Error() string        { return e.template.Error() }
+func (e *FrozenError) Unwrap() error        { return e.template }
+func (e *FrozenError) Is(target error) bool { return target == ErrFrozen }
+
+// freezable is implemented by resolvers that can be frozen
+type freezable interface {
+	Freeze()
+	IsFrozen() bool
+}
+
+// Freeze seals discovery (see FreezeWithOptions)
+func (d *ItemDiscovery) Freeze() {
+	d.FreezeWithOptions(FoNone)
+}
+
+// FreezeWithOptions rejects every later change to discovery
+//
+//	Notes
+//		AddItem, AddKeyedItem, AddOwnedItem, TryRemoveItem and
+//		TryRemoveKeyedItem return a *FrozenError, and RemoveItem and
+//		RemoveKeyedItem panic with it. The resolver of discovery is frozen as
+//		well, if it supports it (see BaseItemResolver.Freeze), unless it is
+//		shared with a base discovery, whose wiring is not frozen by its super
+//		discoveries
+//
+//		Unless FoAllowCaching is specified, items that have not been resolved
+//		can no longer be resolved, except for the exclusive use of callers
+//		(RoInstanceItem and LtTransient), and Shutdown closes items without
+//		removing them
+//
+//		Discovery cannot be unfrozen, but a discovery frozen with
+//		FoAllowCaching can be sealed by a later call to Freeze
+func (d *ItemDiscovery) FreezeWithOptions(options FreezeOptions) {
+	state := frozenSealed
+	if (options & FoAllowCaching) != 0 {
+		state = frozenCaching
+	}
+
+	if r, ok := d.resolver.(freezable); ok && !d.sharedResolver {
+		r.Freeze()
+	}
+
+	// changes check the state while holding the lock, so once sealed, no
+	// change to items can be in progress
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if state > d.frozen.Load() {
+		d.frozen.Store(state)
+	}
+}
+
+// IsFrozen returns true if discovery has been frozen
+func (d *ItemDiscovery) IsFrozen() bool {
+	return d.frozen.Load() != notFrozen
+}
+
+// sealed returns true if discovery has been frozen without FoAllowCaching,
+// in which case items never change
+func (d *ItemDiscovery) sealed() bool {
+	return d.frozen.Load() == frozenSealed
+}
+
+// Freeze rejects every later change to the mappings of the resolver
+//
+//	Notes
+//		The Try variants of the methods that change mappings (e.g.
+//		TryAddMapping) return a *FrozenError, the other methods panic with
+//		it
+func (r *BaseItemResolver) Freeze() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.frozen.Store(true)
+}
+
+// IsFrozen returns true if the resolver has been frozen
+func (r *BaseItemResolver) IsFrozen() bool {
+	return r.frozen.Load()
+}
@@ -0,0 +1,147 @@
+package discovery
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFreezeResolver(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.AddMapping(versionMapping(1))
+	resolver.Freeze()
+	assert.True(t, resolver.IsFrozen())
+
+	err := resolver.TryAddMapping(versionMapping(2))
+	assert.ErrorIs(t, err, ErrFrozen)
+
+	var frozen *FrozenError
+	if assert.ErrorAs(t, err, &frozen) {
+		assert.Equal(t, TypeKey(versionedType), frozen.Key)
+	}
+
+	// every change has a variant that returns the error
+	_, err = resolver.TryRemoveMapping(TypeKey(versionedType), MoNone)
+	assert.ErrorIs(t, err, ErrFrozen)
+	_, err = resolver.TryReplaceMapping(versionMapping(2), MoNone)
+	assert.ErrorIs(t, err, ErrFrozen)
+	assert.ErrorIs(t, resolver.TryAddAOMapping(AOResolverMapping{Type: versionedType}), ErrFrozen)
+	assert.ErrorIs(t, resolver.TryAddAOMappings([]AOResolverMapping{{Type: versionedType}}), ErrFrozen)
+	_, err = resolver.TryRemoveAOMapping(versionedType, MoNone)
+	assert.ErrorIs(t, err, ErrFrozen)
+
+	// the other methods panic with the error
+	assertPanicsFrozen := func(fn func()) {
+		defer func() {
+			err, _ := recover().(error)
+			assert.ErrorIs(t, err, ErrFrozen)
+		}()
+		fn()
+	}
+	assertPanicsFrozen(func() { resolver.AddMapping(versionMapping(2)) })
+	assertPanicsFrozen(func() { resolver.RemoveMapping(TypeKey(versionedType), MoNone) })
+	assertPanicsFrozen(func() { resolver.ReplaceMapping(versionMapping(2), MoNone) })
+	assertPanicsFrozen(func() { resolver.AddAOMapping(AOResolverMapping{Type: versionedType}) })
+	assertPanicsFrozen(func() { resolver.RemoveAOMapping(versionedType, MoNone) })
+	assert.Empty(t, resolver.AOMappings())
+
+	// the resolver is still usable after a rejected change
+	mapping, ok := resolver.GetMapping(versionedType)
+	assert.True(t, ok)
+	assert.Equal(t, versionedType, mapping.Type)
+}
+
+func TestFreezeDiscovery(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.AddMappingsVar(versionMapping(1), ResolverMapping{Type: testItemType, Creator: dependsOn()})
+
+	d := NewItemDiscovery(resolver)
+	_, err := Get[*versionedItem](d)
+	assert.NoError(t, err)
+
+	d.Freeze()
+	assert.True(t, d.IsFrozen())
+	assert.True(t, resolver.IsFrozen())
+
+	assert.ErrorIs(t, Set(d, &versionedItem{}), ErrFrozen)
+	assert.ErrorIs(t, d.AddOwnedItem(TypeKey(versionedType), &versionedItem{}), ErrFrozen)
+	assert.ErrorIs(t, d.TryRemoveItem(versionedType), ErrFrozen)
+	assert.Panics(t, func() { d.RemoveItem(versionedType) })
+	assert.True(t, d.HasItem(versionedType))
+
+	// the generic helpers return the error
+	assert.ErrorIs(t, Remove[*versionedItem](d), ErrFrozen)
+	assert.ErrorIs(t, Provide(d, func(d Discovery) (*versionedItem, error) { return nil, nil }), ErrFrozen)
+
+	// resolved items are read without locking
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			item, err := Get[*versionedItem](d)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, item.version)
+		}()
+	}
+	wg.Wait()
+
+	// unresolved items cannot be cached, but can be created for the caller
+	_, err = d.GetItem(testItemType)
+	assert.ErrorIs(t, err, ErrFrozen)
+
+	_, err = d.GetItemWithOptions(testItemType, RoInstanceItem)
+	assert.NoError(t, err)
+	assert.False(t, d.HasItem(testItemType))
+}
+
+func TestFreezeAllowCaching(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.AddMapping(versionMapping(1))
+
+	d := NewItemDiscovery(resolver)
+	d.FreezeWithOptions(FoAllowCaching)
+
+	assert.ErrorIs(t, Set(d, &versionedItem{}), ErrFrozen)
+
+	_, err := Get[*versionedItem](d)
+	assert.NoError(t, err)
+	assert.True(t, d.HasItem(versionedType))
+
+	// caching can be sealed later, but a sealed discovery is not unsealed
+	d.Freeze()
+	assert.True(t, d.sealed())
+	d.FreezeWithOptions(FoAllowCaching)
+	assert.True(t, d.sealed())
+}
+
+func TestFreezeSuperDiscovery(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.AddMapping(versionMapping(1))
+	base := NewItemDiscovery(resolver)
+
+	// items owned by an unfrozen base are still resolved by the base
+	super := NewItemDiscoveryWithBase(base, nil)
+	super.Freeze()
+
+	item, err := Get[*versionedItem](super)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, item.version)
+	assert.True(t, base.HasItem(versionedType))
+}
+
+func TestFreezeSharedResolver(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	base := NewItemDiscovery(resolver)
+
+	// the wiring of the base is not frozen by its super discovery
+	super := NewItemDiscoveryWithBase(base, resolver)
+	super.Freeze()
+	assert.True(t, super.IsFrozen())
+	assert.False(t, resolver.IsFrozen())
+	assert.NoError(t, resolver.TryAddMapping(versionMapping(1)))
+
+	base.Freeze()
+	assert.True(t, resolver.IsFrozen())
+}
@@ -0,0 +1,132 @@
+package discovery
+
+import "reflect"
+
+// TypeOf returns the reflected type of T, which is the item type used by the
+// generic helpers
+//
+//	Notes
+//		For interface types, T is the interface itself (e.g. TypeOf[Logger]()
+//		is equivalent to reflect.TypeOf((*Logger)(nil)).Elem())
+func TypeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// Provide adds a mapping for T to the resolver of d
+//
+//	Params
+//	  d - optional Discovery, default discovery is used if nil
+//	  creator - creates instances of T
+//
+//	Notes
+//		d must implement ItemDiscoveryManagement
+//
+//		A *DuplicateError is returned if the mapping is rejected by CpError,
+//		or a *FrozenError if the resolver is frozen
+func Provide[T any](d Discovery, creator func(d Discovery) (T, error)) error {
+	mapping := ResolverMapping{
+		Type: TypeOf[T](),
+		Creator: func(d Discovery) (interface{}, error) {
+			item, err := creator(d)
+			if err != nil {
+				return nil, err
+			}
+			return item, nil
+		},
+	}
+
+	resolver := managementOf(d).GetResolver()
+	if r, ok := resolver.(sourcedResolver); ok {
+		_, err := r.tryAddMappings([]ResolverMapping{mapping}, callerSource())
+		return err
+	}
+
+	resolver.AddMapping(mapping)
+	return nil
+}
+
+// Set adds value as the item for T
+//
+//	Params
+//	  d - optional Discovery, default discovery is used (and created) if nil
+//
+//	Notes
+//		d must implement ItemDiscoveryManagement
+func Set[T any](d Discovery, value T) error {
+	if d == nil {
+		d = GetOrCreateDefaultDiscovery(nil)
+	}
+
+	// a nil interface value has no type to check against T
+	if any(value) == nil {
+		return newItemTypeError(errorContext(d, TypeKey(TypeOf[T]())), TypeOf[T](), nil, "")
+	}
+
+	return managementOf(d).AddItem(TypeOf[T](), value)
+}
+
+// Get returns the item for T, resolving it if necessary
+//
+//	Params
+//	  d - optional Discovery, default discovery is used if nil
+func Get[T any](d Discovery) (T, error) {
+	return GetItem[T](d, TypeOf[T]())
+}
+
+// MustGet returns the item for T, resolving it if necessary, and panics if
+// the item cannot be acquired
+//
+//	Params
+//	  d - optional Discovery, default discovery is used if nil
+func MustGet[T any](d Discovery) T {
+	return GetRequiredItem[T](d, TypeOf[T]())
+}
+
+// Has returns true if d has an item for T
+//
+//	Params
+//	  d - optional Discovery, default discovery is used if nil
+//
+//	Notes
+//		Items that have a mapping but have not been resolved are not reported
+func Has[T any](d Discovery) bool {
+	if d == nil {
+		d = GetDefaultDiscoveryOrPanic()
+	}
+
+	return d.HasItem(TypeOf[T]())
+}
+
+// Remove removes the item for T
+//
+//	Params
+//	  d - optional Discovery, default discovery is used if nil
+//
+//	Notes
+//		d must implement ItemDiscoveryManagement
+//
+//		A *FrozenError is returned if d is frozen
+func Remove[T any](d Discovery) error {
+	m := managementOf(d)
+	if r, ok := m.(tryRemover); ok {
+		return r.TryRemoveItem(TypeOf[T]())
+	}
+
+	m.RemoveItem(TypeOf[T]())
+	return nil
+}
+
+// tryRemover is implemented by discoveries that return an error for rejected
+// removals (see ItemDiscovery.TryRemoveItem)
+type tryRemover interface {
+	TryRemoveItem(itemType reflect.Type) error
+}
+
+// managementOf returns d (or default discovery) as ItemDiscoveryManagement
+func managementOf(d Discovery) ItemDiscoveryManagement {
+	if d == nil {
+		d = GetDefaultDiscoveryOrPanic()
+	}
+
+	return d.(ItemDiscoveryManagement)
+}
@@ -1,6 +1,6 @@
 module github.com/gotomgo/discovery
 
-go 1.21.3
+go 1.24
 
 replace github.com/gotomgo/coreutils => /Users/tom/go/src/github.com/gotomgo/coreutils
 
@@ -0,0 +1,242 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DependencyGraph is a snapshot of the dependencies recorded by discovery
+// while resolving items
+//
+//	Notes
+//		An edge From -> To indicates that the Creator (or AO creators) of From
+//		acquired To from discovery during resolution
+//
+//		Layer is the layer of the discovery that resolved the item, numbered
+//		as ErrorContext.Layer: 0 for the discovery without a base, 1 for a
+//		super discovery of it, and so on. Items that were acquired but never
+//		resolved (e.g. items added via AddItem) have Resolved == false, and
+//		the layer of the discovery the graph was taken from
+type DependencyGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is an item of a DependencyGraph
+type GraphNode struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Name     string `json:"name,omitempty"`
+	Layer    int    `json:"layer"`
+	Resolved bool   `json:"resolved"`
+}
+
+// GraphEdge is a dependency between two items of a DependencyGraph
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// graphSource is implemented by discoveries that record dependencies
+type graphSource interface {
+	collectGraph(b *graphBuilder)
+}
+
+// recordDependencies records the dependencies of the latest resolution of key
+func (d *ItemDiscovery) recordDependencies(key ItemKey, deps []ItemKey) {
+	d.graphLock.Lock()
+	defer d.graphLock.Unlock()
+
+	d.dependencies[key] = deps
+}
+
+// DependencyGraph returns the dependencies recorded by discovery and its base
+// discoveries
+func (d *ItemDiscovery) DependencyGraph() *DependencyGraph {
+	b := &graphBuilder{nodes: map[string]*GraphNode{}, edges: map[GraphEdge]bool{}}
+	d.collectGraph(b)
+	return b.build(d.layer())
+}
+
+func (d *ItemDiscovery) collectGraph(b *graphBuilder) {
+	layer := d.layer()
+
+	d.graphLock.Lock()
+	for key, deps := range d.dependencies {
+		b.addResolved(key, layer)
+		for _, dep := range deps {
+			b.addEdge(key, dep)
+		}
+	}
+	d.graphLock.Unlock()
+
+	if source, ok := d.baseDiscovery.(graphSource); ok {
+		source.collectGraph(b)
+	}
+}
+
+// graphBuilder accumulates the nodes and edges of a DependencyGraph
+type graphBuilder struct {
+	nodes map[string]*GraphNode
+	edges map[GraphEdge]bool
+}
+
+func (b *graphBuilder) node(key ItemKey) *GraphNode {
+	id := key.String()
+
+	node, ok := b.nodes[id]
+	if !ok {
+		node = &GraphNode{ID: id, Type: typeName(key.Type), Name: key.Name, Layer: -1}
+		b.nodes[id] = node
+	}
+
+	return node
+}
+
+// addResolved adds a resolved item. The item is attributed to the first
+// layer that resolved it, starting from the discovery the graph is taken from
+func (b *graphBuilder) addResolved(key ItemKey, layer int) {
+	node := b.node(key)
+
+	if !node.Resolved {
+		node.Resolved = true
+		node.Layer = layer
+	}
+}
+
+func (b *graphBuilder) addEdge(from ItemKey, to ItemKey) {
+	b.node(to)
+	b.edges[GraphEdge{From: b.node(from).ID, To: b.node(to).ID}] = true
+}
+
+// build returns the graph, with unresolved items attributed to layer
+func (b *graphBuilder) build(layer int) *DependencyGraph {
+	g := &DependencyGraph{
+		Nodes: make([]GraphNode, 0, len(b.nodes)),
+		Edges: make([]GraphEdge, 0, len(b.edges)),
+	}
+
+	for _, node := range b.nodes {
+		if node.Layer < 0 {
+			node.Layer = layer
+		}
+		g.Nodes = append(g.Nodes, *node)
+	}
+
+	for edge := range b.edges {
+		g.Edges = append(g.Edges, edge)
+	}
+
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+
+	return g
+}
+
+// DependenciesOf returns the IDs of the items that id directly depends on
+func (g *DependencyGraph) DependenciesOf(id string) []string {
+	var result []string
+
+	for _, edge := range g.Edges {
+		if edge.From == id {
+			result = append(result, edge.To)
+		}
+	}
+
+	return result
+}
+
+// DOT returns the graph in Graphviz DOT format
+//
+//	Notes
+//		Items that were not resolved are drawn dashed, and items resolved by
+//		base discoveries (every layer below the highest) are grouped by layer
+func (g *DependencyGraph) DOT() string {
+	var buf bytes.Buffer
+
+	buf.WriteString("digraph discovery {\n")
+	buf.WriteString("  rankdir=LR;\n")
+	buf.WriteString("  node [shape=box];\n")
+
+	maxLayer := 0
+	layers := map[int][]GraphNode{}
+	for _, node := range g.Nodes {
+		layers[node.Layer] = append(layers[node.Layer], node)
+		if node.Layer > maxLayer {
+			maxLayer = node.Layer
+		}
+	}
+
+	for layer := maxLayer; layer >= 0; layer-- {
+		nodes, ok := layers[layer]
+		if !ok {
+			continue
+		}
+
+		indent := "  "
+		if layer < maxLayer {
+			fmt.Fprintf(&buf, "  subgraph cluster_layer%d {\n", layer)
+			fmt.Fprintf(&buf, "    label=%s;\n", strconv.Quote(fmt.Sprintf("layer %d", layer)))
+			indent = "    "
+		}
+
+		for _, node := range nodes {
+			style := ""
+			if !node.Resolved {
+				style = ", style=dashed"
+			}
+			fmt.Fprintf(&buf, "%s%s [label=%s%s];\n", indent, strconv.Quote(node.ID), strconv.Quote(node.ID), style)
+		}
+
+		if layer < maxLayer {
+			buf.WriteString("  }\n")
+		}
+	}
+
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&buf, "  %s -> %s;\n", strconv.Quote(edge.From), strconv.Quote(edge.To))
+	}
+
+	buf.WriteString("}\n")
+
+	return buf.String()
+}
+
+// Mermaid returns the graph as a Mermaid flowchart
+func (g *DependencyGraph) Mermaid() string {
+	var buf bytes.Buffer
+
+	buf.WriteString("flowchart LR\n")
+
+	ids := make(map[string]string, len(g.Nodes))
+	for i, node := range g.Nodes {
+		ids[node.ID] = fmt.Sprintf("n%d", i)
+
+		label := strings.ReplaceAll(node.ID, `"`, "#quot;")
+		if node.Resolved {
+			fmt.Fprintf(&buf, "  %s[\"%s\"]\n", ids[node.ID], label)
+		} else {
+			fmt.Fprintf(&buf, "  %s([\"%s\"])\n", ids[node.ID], label)
+		}
+	}
+
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&buf, "  %s --> %s\n", ids[edge.From], ids[edge.To])
+	}
+
+	return buf.String()
+}
+
+// JSON returns the graph as indented JSON
+func (g *DependencyGraph) JSON() ([]byte, error) {
+	return json.MarshalIndent(g, "", "  ")
+}
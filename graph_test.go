@@ -0,0 +1,68 @@
+package discovery
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	d := NewItemDiscovery(newServiceResolver(&lifecycleLog{}, nil))
+	assert.NoError(t, d.AddItem(testItemType, &testItemImpl{}))
+
+	superD := NewItemDiscoveryWithBase(d, nil)
+	superD.GetResolver().AddMapping(ResolverMapping{
+		Type: MockServiceType,
+		Creator: func(d Discovery) (interface{}, error) {
+			d.GetRequiredItem(lifecycleBType)
+			d.GetRequiredItem(testItemType)
+			return &MockService{}, nil
+		},
+	})
+
+	superD.GetRequiredItem(MockServiceType)
+
+	g := superD.DependencyGraph()
+
+	mockID := TypeKey(MockServiceType).String()
+	aID := TypeKey(lifecycleAType).String()
+	bID := TypeKey(lifecycleBType).String()
+	testID := TypeKey(testItemType).String()
+
+	assert.Equal(t, []string{bID, testID}, g.DependenciesOf(mockID))
+	assert.Equal(t, []string{aID}, g.DependenciesOf(bID))
+	assert.Len(t, g.Nodes, 4)
+
+	for _, node := range g.Nodes {
+		switch node.ID {
+		case mockID:
+			assert.Equal(t, 1, node.Layer)
+			assert.True(t, node.Resolved)
+			assert.Equal(t, typeName(MockServiceType), node.Type)
+		case aID, bID:
+			assert.Equal(t, 0, node.Layer)
+			assert.True(t, node.Resolved)
+		case testID:
+			assert.Equal(t, 1, node.Layer)
+			assert.False(t, node.Resolved)
+		}
+	}
+
+	dot := g.DOT()
+	assert.True(t, strings.HasPrefix(dot, "digraph discovery {"))
+	assert.Contains(t, dot, `"`+mockID+`" -> "`+bID+`";`)
+	assert.Contains(t, dot, "subgraph cluster_layer0")
+
+	mermaid := g.Mermaid()
+	assert.True(t, strings.HasPrefix(mermaid, "flowchart LR"))
+	assert.Equal(t, 3, strings.Count(mermaid, "-->"))
+
+	data, err := g.JSON()
+	assert.NoError(t, err)
+
+	var decoded DependencyGraph
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, *g, decoded)
+}
@@ -11,23 +11,29 @@ import (
 var defaultD atomic.Value
 var createLock sync.Mutex
 
+// defaultHolder is the value of defaultD, which allows the default discovery
+// to be cleared (atomic.Value cannot store nil)
+type defaultHolder struct {
+	d Discovery
+}
+
 // GetDefaultDiscovery returns the value for the default discovery
 func GetDefaultDiscovery() Discovery {
-	d := defaultD.Load()
-	if d == nil {
+	holder, ok := defaultD.Load().(defaultHolder)
+	if !ok {
 		return nil
 	}
-	return d.(Discovery)
+	return holder.d
 }
 
 // GetDefaultDiscoveryOrPanic returns the value for the default discovery
 // and panics if the default discovery has not been set
 func GetDefaultDiscoveryOrPanic() Discovery {
-	d := defaultD.Load()
+	d := GetDefaultDiscovery()
 	if d == nil {
 		panic(fmt.Errorf("default Discovery Service not initialized"))
 	}
-	return d.(Discovery)
+	return d
 }
 
 // GetOrCreateDefaultDiscovery gets the current default discovery,
@@ -45,23 +51,119 @@ func GetOrCreateDefaultDiscovery(resolver ItemResolver) Discovery {
 
 	d := GetDefaultDiscovery()
 	if d == nil {
-		d = SetDefaultDiscovery(NewDiscovery(resolver))
+		d = NewDiscovery(resolver)
+		setDefaultDiscovery(d)
 	}
 
 	return d
 }
 
 // SetDefaultDiscovery stores the default discovery
+//
+//	Notes
+//		A nil d clears the default discovery
+//
+//		While discoveries are pushed (see PushDefaultDiscovery), d replaces
+//		the default discovery that is restored once every pushed discovery is
+//		popped, and the pushed discoveries remain the default until then
 func SetDefaultDiscovery(d Discovery) Discovery {
-	defaultD.Store(d)
+	createLock.Lock()
+	defer createLock.Unlock()
+
+	setDefaultDiscovery(d)
 	return d
 }
 
+// setDefaultDiscovery stores the default discovery, createLock must be held
+func setDefaultDiscovery(d Discovery) {
+	defaultBase = d
+	if len(defaultScopes) == 0 {
+		defaultD.Store(defaultHolder{d: d})
+	}
+}
+
+// defaultScope is an entry of the stack of default discoveries pushed by
+// PushDefaultDiscovery
+type defaultScope struct {
+	d      Discovery
+	popped bool
+}
+
+// defaultScopes and defaultBase are guarded by createLock. defaultBase is
+// the default discovery when no discovery is pushed
+var defaultScopes []*defaultScope
+var defaultBase Discovery
+
+// PushDefaultDiscovery replaces the default discovery with d until the
+// returned pop func is called
+//
+//	Notes
+//		Pushes nest: the default discovery is the discovery pushed last that
+//		has not been popped, or the discovery set by SetDefaultDiscovery if
+//		every pushed discovery has been popped. Pops may occur in any order,
+//		so pushes of concurrent goroutines cannot restore the wrong default
+//		discovery, but they do replace the default discovery of each other
+//		while pushed
+//
+//		Each pop func can only be called once, and panics otherwise
+func PushDefaultDiscovery(d Discovery) (pop func()) {
+	createLock.Lock()
+	defer createLock.Unlock()
+
+	scope := &defaultScope{d: d}
+	defaultScopes = append(defaultScopes, scope)
+	defaultD.Store(defaultHolder{d: d})
+
+	return func() {
+		createLock.Lock()
+		defer createLock.Unlock()
+
+		if scope.popped {
+			panic(fmt.Errorf("default discovery popped more than once"))
+		}
+		scope.popped = true
+
+		for i, pushed := range defaultScopes {
+			if pushed == scope {
+				defaultScopes = append(defaultScopes[:i], defaultScopes[i+1:]...)
+				break
+			}
+		}
+
+		current := defaultBase
+		if last := len(defaultScopes) - 1; last >= 0 {
+			current = defaultScopes[last].d
+		}
+		defaultD.Store(defaultHolder{d: current})
+	}
+}
+
+// WithDefaultDiscovery calls fn with d as the default discovery, and
+// restores the previous default discovery when fn returns (or panics)
+//
+//	Notes
+//		Calls nest (see PushDefaultDiscovery), including calls made by fn or
+//		by subtests that fn runs. Calls made concurrently by unrelated
+//		goroutines are not isolated from each other: tests that run in
+//		parallel and rely on the default discovery should use AsDefault of
+//		discoverytest.Discovery, which runs the scopes of unrelated tests one
+//		at a time
+func WithDefaultDiscovery(d Discovery, fn func()) {
+	pop := PushDefaultDiscovery(d)
+	defer pop()
+
+	fn()
+}
+
 // CreateSuperDiscovery creates a new discovery that "super classes" the
 // default discovery
 //
 //	Params
 //	  resolver - optional ItemResolver
+//
+//	Notes
+//		Items mapped by the default discovery are resolved and cached by it,
+//		even if resolver is the default resolver (see NewItemDiscoveryWithBase)
 func CreateSuperDiscovery(resolver ItemResolver) Discovery {
 	return NewDiscoveryWithBase(GetDefaultDiscoveryOrPanic(), resolver)
 }
@@ -85,7 +187,12 @@ func GetRequiredItem[T any](d Discovery, itemType reflect.Type) T {
 		d = GetDefaultDiscoveryOrPanic()
 	}
 
-	return d.GetRequiredItem(itemType).(T)
+	item, err := itemAs[T](d, itemType, d.GetRequiredItem(itemType))
+	if err != nil {
+		panic(err)
+	}
+
+	return item
 }
 
 func GetItem[T any](d Discovery, itemType reflect.Type) (T, error) {
@@ -99,7 +206,7 @@ func GetItem[T any](d Discovery, itemType reflect.Type) (T, error) {
 		return zero, err
 	}
 
-	return item.(T), nil
+	return itemAs[T](d, itemType, item)
 }
 
 func Resolve[T any](d Discovery, mapping ResolverMapping) T {
@@ -108,5 +215,25 @@ func Resolve[T any](d Discovery, mapping ResolverMapping) T {
 		panic(fmt.Errorf("error resolving '%t': %s", mapping.Type, err))
 	}
 
-	return item.(T)
+	result, err := itemAs[T](d, mapping.Type, item)
+	if err != nil {
+		panic(err)
+	}
+
+	return result
+}
+
+// itemAs returns item as T, or an *ItemTypeError if item is not a T
+//
+//	Notes
+//		Items are only checked against their item type when they are added or
+//		resolved, and convertible items (see SetStrictTypes) are not
+//		necessarily a T
+func itemAs[T any](d Discovery, itemType reflect.Type, item interface{}) (T, error) {
+	result, ok := item.(T)
+	if !ok {
+		return result, newItemTypeError(errorContext(d, TypeKey(itemType)), TypeOf[T](), item, "")
+	}
+
+	return result, nil
 }
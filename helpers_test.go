@@ -2,7 +2,7 @@ package discovery
 
 import (
 	"reflect"
-	"sync/atomic"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -15,7 +15,16 @@ var _ testItem = &testItemImpl{}
 
 var testItemType = reflect.TypeOf((*testItem)(nil)).Elem()
 
+// clearDefaultDiscovery clears default discovery for the duration of a test
+func clearDefaultDiscovery(t *testing.T) {
+	previous := GetDefaultDiscovery()
+	SetDefaultDiscovery(nil)
+	t.Cleanup(func() { SetDefaultDiscovery(previous) })
+}
+
 func TestDefaultDiscovery(t *testing.T) {
+	clearDefaultDiscovery(t)
+
 	// should be nothing set, and GetDefaultDiscovery should still work
 	assert.Nil(t, GetDefaultDiscovery())
 	assert.Panics(t, func() { GetItem[*testItem](nil, testItemType) })
@@ -61,7 +70,7 @@ func TestDefaultDiscovery(t *testing.T) {
 
 func TestAddItem(t *testing.T) {
 	// clear any value for default discovery
-	defaultD = atomic.Value{}
+	clearDefaultDiscovery(t)
 	assert.Nil(t, GetDefaultDiscovery())
 
 	AddItem(testItemType, &testItemImpl{})
@@ -70,3 +79,100 @@ func TestAddItem(t *testing.T) {
 	item := GetRequiredItem[testItem](GetDefaultDiscovery(), testItemType)
 	assert.NotNil(t, item)
 }
+
+func TestGenericHelpers(t *testing.T) {
+	d := NewDiscovery(nil)
+
+	assert.False(t, Has[testItem](d))
+
+	assert.NoError(t, Provide(d, func(d Discovery) (testItem, error) {
+		return &testItemImpl{}, nil
+	}))
+
+	item, err := Get[testItem](d)
+	assert.NoError(t, err)
+	assert.NotNil(t, item)
+	assert.True(t, Has[testItem](d))
+	assert.Same(t, item, MustGet[testItem](d))
+
+	assert.NoError(t, Remove[testItem](d))
+	assert.False(t, Has[testItem](d))
+
+	impl := &testItemImpl{}
+	assert.NoError(t, Set(d, impl))
+	assert.Same(t, impl, MustGet[*testItemImpl](d))
+
+	assert.Error(t, Set[testItem](d, nil))
+
+	_, err = Get[*MockService](d)
+	assert.Error(t, err)
+	assert.Panics(t, func() { MustGet[*MockService](d) })
+}
+
+func TestPushDefaultDiscovery(t *testing.T) {
+	clearDefaultDiscovery(t)
+
+	d1 := NewDiscovery(nil)
+	d2 := NewDiscovery(nil)
+
+	pop1 := PushDefaultDiscovery(d1)
+	assert.Equal(t, d1, GetDefaultDiscovery())
+
+	pop2 := PushDefaultDiscovery(d2)
+	assert.Equal(t, d2, GetDefaultDiscovery())
+
+	// sets while pushed replace the discovery restored by the last pop
+	d3 := NewDiscovery(nil)
+	SetDefaultDiscovery(d3)
+	assert.Equal(t, d2, GetDefaultDiscovery())
+
+	// pops may occur in any order
+	pop1()
+	assert.Equal(t, d2, GetDefaultDiscovery())
+	assert.Panics(t, pop1)
+
+	pop2()
+	assert.Equal(t, d3, GetDefaultDiscovery())
+	assert.Panics(t, pop2)
+}
+
+func TestWithDefaultDiscovery(t *testing.T) {
+	clearDefaultDiscovery(t)
+
+	outer := NewDiscovery(nil)
+	WithDefaultDiscovery(outer, func() {
+		assert.NoError(t, AddItem(testItemType, &testItemImpl{}))
+		assert.True(t, outer.HasItem(testItemType))
+
+		// nested calls, including calls of subtests, do not wait
+		t.Run("nested", func(t *testing.T) {
+			WithDefaultDiscovery(CreateSuperDiscovery(nil), func() {
+				assert.NotEqual(t, outer, GetDefaultDiscovery())
+				_, err := GetItem[testItem](nil, testItemType)
+				assert.NoError(t, err)
+			})
+		})
+
+		assert.Equal(t, outer, GetDefaultDiscovery())
+	})
+
+	// concurrent calls restore the previous default discovery, whatever
+	// order they complete in
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			WithDefaultDiscovery(NewDiscovery(nil), func() {})
+		}()
+	}
+	wg.Wait()
+
+	assert.Nil(t, GetDefaultDiscovery())
+
+	// the previous default discovery is restored if fn panics
+	assert.Panics(t, func() {
+		WithDefaultDiscovery(NewDiscovery(nil), func() { panic("failed") })
+	})
+	assert.Nil(t, GetDefaultDiscovery())
+}
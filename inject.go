@@ -0,0 +1,165 @@
+package discovery
+
+import (
+	stderrors "errors"
+	"reflect"
+	"strings"
+	"unsafe"
+)
+
+// InjectTag is the struct tag that marks fields for injection
+//
+//	Notes
+//		The tag value is a comma separated list of
+//		  name=<name> - inject the named item (see ItemKey)
+//		  optional    - leave the field unchanged if there is no item or mapping
+//		  instance    - inject an item created for exclusive use (RoInstanceItem)
+//		  noresolve   - inject an existing item only (RoDontResolve)
+//
+//		An empty value (`discovery:""`) injects the unnamed item
+const InjectTag = "discovery"
+
+// InjectOptions represents flag values used by InjectWithOptions
+type InjectOptions int
+
+const (
+	// IoNone represents no inject options
+	IoNone InjectOptions = 0
+	// IoUnexported is used to indicate that tagged unexported fields are
+	// injected as well
+	IoUnexported InjectOptions = 1 << 0
+)
+
+// injectField is a parsed InjectTag
+type injectField struct {
+	name     string
+	optional bool
+	options  ResolveOptions
+}
+
+// Inject sets the exported fields of the struct that target points to that
+// are tagged with InjectTag
+//
+//	Params
+//	  d - optional Discovery, default discovery is used if nil
+//	  target - pointer to a struct
+//
+//	Notes
+//		Every field is attempted, and every failure is reported in the
+//		returned error
+func Inject(d Discovery, target interface{}) error {
+	return InjectWithOptions(d, target, IoNone)
+}
+
+// InjectWithOptions is Inject with options (see InjectOptions)
+func InjectWithOptions(d Discovery, target interface{}, options InjectOptions) error {
+	if d == nil {
+		d = GetDefaultDiscoveryOrPanic()
+	}
+
+	value := reflect.ValueOf(target)
+	if (value.Kind() != reflect.Pointer) || value.IsNil() || (value.Elem().Kind() != reflect.Struct) {
+		return ErrInvalidInjectTarget.Instance(reflect.TypeOf(target))
+	}
+
+	value = value.Elem()
+	structType := value.Type()
+
+	var errs []error
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		tag, ok := field.Tag.Lookup(InjectTag)
+		if !ok {
+			continue
+		}
+
+		if !field.IsExported() && ((options & IoUnexported) == 0) {
+			continue
+		}
+
+		spec, err := parseInjectTag(tag)
+		if err != nil {
+			errs = append(errs, ErrFieldNotInjected.Instance(structType, field.Name, err).WithInner(err))
+			continue
+		}
+
+		key := NamedKey(field.Type, spec.name)
+
+		if spec.optional && !canAcquire(d, key) {
+			continue
+		}
+
+		item, err := d.GetKeyedItemWithOptions(key, spec.options)
+		if err != nil {
+			errs = append(errs, ErrFieldNotInjected.Instance(structType, field.Name, err).WithInner(err))
+			continue
+		}
+
+		itemValue := reflect.ValueOf(item)
+		if !itemValue.Type().AssignableTo(field.Type) {
+			err = newItemTypeError(errorContext(d, TypeKey(field.Type)), field.Type, item, "")
+			errs = append(errs, ErrFieldNotInjected.Instance(structType, field.Name, err).WithInner(err))
+			continue
+		}
+
+		fieldValue := value.Field(i)
+		if !field.IsExported() {
+			fieldValue = reflect.NewAt(field.Type, unsafe.Pointer(fieldValue.UnsafeAddr())).Elem()
+		}
+
+		fieldValue.Set(itemValue)
+	}
+
+	return stderrors.Join(errs...)
+}
+
+// parseInjectTag parses the value of an InjectTag
+func parseInjectTag(tag string) (injectField, error) {
+	var spec injectField
+
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+
+		switch {
+		case part == "":
+		case part == "optional":
+			spec.optional = true
+		case part == "instance":
+			spec.options |= RoInstanceItem
+		case part == "noresolve":
+			spec.options |= RoDontResolve
+		case strings.HasPrefix(part, "name="):
+			spec.name = strings.TrimPrefix(part, "name=")
+		default:
+			return spec, ErrInvalidInjectTag.Instance(tag)
+		}
+	}
+
+	return spec, nil
+}
+
+// canAcquire returns true if d has an item for key, or a mapping to resolve it
+//
+//	Notes
+//		Discoveries that do not expose their mappings are assumed to be able to
+//		resolve key
+func canAcquire(d Discovery, key ItemKey) bool {
+	if d.HasKeyedItem(key) {
+		return true
+	}
+
+	finder, ok := d.(mappingFinder)
+	if !ok {
+		return true
+	}
+
+	if _, _, ok = finder.findMapping(key); ok {
+		return true
+	}
+
+	// the item may have been added to a base discovery
+	_, err := d.GetKeyedItemWithOptions(key, RoDontResolve)
+	return err == nil
+}
@@ -0,0 +1,77 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type injectTarget struct {
+	Service  *MockService `discovery:""`
+	Primary  *MockService `discovery:"name=primary"`
+	Instance *MockService `discovery:"instance"`
+	Optional testItem     `discovery:"optional"`
+	Ignored  *MockService
+	private  *MockService `discovery:"name=primary"`
+}
+
+func newInjectDiscovery() *ItemDiscovery {
+	resolver := NewBaseItemResolver()
+	resolver.AddMappingsVar(
+		ResolverMapping{
+			Type: MockServiceType,
+			Creator: func(d Discovery) (interface{}, error) {
+				return &MockService{field: 1}, nil
+			},
+		},
+		ResolverMapping{
+			Type: MockServiceType,
+			Name: "primary",
+			Creator: func(d Discovery) (interface{}, error) {
+				return &MockService{field: 2}, nil
+			},
+		})
+
+	return NewItemDiscovery(resolver)
+}
+
+func TestInject(t *testing.T) {
+	d := newInjectDiscovery()
+
+	var target injectTarget
+	assert.NoError(t, Inject(d, &target))
+
+	assert.Same(t, d.GetRequiredItem(MockServiceType), target.Service)
+	assert.Equal(t, 2, target.Primary.field)
+	assert.NotSame(t, target.Service, target.Instance)
+	assert.Nil(t, target.Optional)
+	assert.Nil(t, target.Ignored)
+	assert.Nil(t, target.private)
+
+	assert.NoError(t, InjectWithOptions(d, &target, IoUnexported))
+	assert.Same(t, target.Primary, target.private)
+
+	// optional items are injected when available
+	assert.NoError(t, d.AddItem(testItemType, &testItemImpl{}))
+	assert.NoError(t, Inject(d, &target))
+	assert.NotNil(t, target.Optional)
+}
+
+func TestInjectReportsEveryFailure(t *testing.T) {
+	d := NewItemDiscovery(nil)
+
+	var target struct {
+		A *MockService `discovery:""`
+		B *MockService `discovery:"name=missing"`
+		C *MockService `discovery:"bogus"`
+	}
+
+	err := Inject(d, &target)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), ".A not injected")
+	assert.Contains(t, err.Error(), ".B not injected")
+	assert.Contains(t, err.Error(), ".C not injected")
+
+	assert.Error(t, Inject(d, target))
+	assert.Error(t, Inject(d, nil))
+}
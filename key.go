@@ -0,0 +1,56 @@
+package discovery
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ItemKey identifies an item in discovery by its type and an optional name
+//
+//	Notes
+//		The zero Name identifies the default (unnamed) item for the type, which
+//		is the item addressed by the reflect.Type based methods of Discovery
+type ItemKey struct {
+	Type reflect.Type
+	Name string
+}
+
+// TypeKey returns the ItemKey of the unnamed item of itemType
+func TypeKey(itemType reflect.Type) ItemKey {
+	return ItemKey{Type: itemType}
+}
+
+// NamedKey returns the ItemKey of the item of itemType registered as name
+func NamedKey(itemType reflect.Type, name string) ItemKey {
+	return ItemKey{Type: itemType, Name: name}
+}
+
+// IsNamed returns true if the key identifies a named item
+func (k ItemKey) IsNamed() bool {
+	return k.Name != ""
+}
+
+// String returns the key as type or type[name], where type is the fully
+// qualified name of the type
+func (k ItemKey) String() string {
+	if k.Name == "" {
+		return typeName(k.Type)
+	}
+
+	return fmt.Sprintf("%s[%s]", typeName(k.Type), k.Name)
+}
+
+// ResolvePath is a chain of items being resolved, where each item was
+// acquired by the Creator of the item that precedes it
+type ResolvePath []ItemKey
+
+// String returns the path as A -> B -> C
+func (p ResolvePath) String() string {
+	parts := make([]string, len(p))
+	for i, key := range p {
+		parts[i] = key.String()
+	}
+
+	return strings.Join(parts, " -> ")
+}
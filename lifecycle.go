@@ -0,0 +1,578 @@
+package discovery
+
+import (
+	"container/list"
+	"context"
+	stderrors "errors"
+	"io"
+	"log"
+	"reflect"
+	"runtime/debug"
+	"sync"
+)
+
+// Starter is implemented by items, such as background services, that need
+// to be started after construction (see ItemDiscovery.Start)
+type Starter interface {
+	Start(ctx context.Context) error
+}
+
+// Stopper is implemented by items that need to release resources when the
+// discovery that owns them is shut down
+//
+//	Notes
+//		Items that implement io.Closer (but not Stopper) are closed instead
+type Stopper interface {
+	Stop(ctx context.Context) error
+}
+
+// ownedItem is an item that discovery is responsible for stopping/closing
+//
+//	Notes
+//		resolved is true for items created by resolution, rather than added
+//		via AddOwnedItem
+//
+//		started and stopped are protected by ItemDiscovery.lifecycleLock
+type ownedItem struct {
+	key      ItemKey
+	item     interface{}
+	deps     []ItemKey
+	resolved bool
+
+	started bool
+	stopped bool
+}
+
+// own records an item as owned by discovery. Items are recorded in the order
+// they are created, so dependencies always precede the items that use them
+func (d *ItemDiscovery) own(key ItemKey, item interface{}, deps []ItemKey, resolved bool) {
+	d.ownedLock.Lock()
+	defer d.ownedLock.Unlock()
+
+	d.owned.PushBack(&ownedItem{key: key, item: item, deps: deps, resolved: resolved})
+}
+
+// disown releases discovery from the responsibility of stopping an item
+func (d *ItemDiscovery) disown(key ItemKey) {
+	d.ownedLock.Lock()
+	defer d.ownedLock.Unlock()
+
+	for e := d.owned.Front(); e != nil; {
+		next := e.Next()
+		if e.Value.(*ownedItem).key == key {
+			d.owned.Remove(e)
+		}
+		e = next
+	}
+}
+
+// disownItem releases discovery from the responsibility of stopping o
+func (d *ItemDiscovery) disownItem(o *ownedItem) {
+	d.ownedLock.Lock()
+	defer d.ownedLock.Unlock()
+
+	for e := d.owned.Front(); e != nil; e = e.Next() {
+		if e.Value.(*ownedItem) == o {
+			d.owned.Remove(e)
+			return
+		}
+	}
+}
+
+// ownedItems returns a snapshot of the owned items in order of creation
+func (d *ItemDiscovery) ownedItems() []*ownedItem {
+	d.ownedLock.Lock()
+	defer d.ownedLock.Unlock()
+
+	result := make([]*ownedItem, 0, d.owned.Len())
+	for e := d.owned.Front(); e != nil; e = e.Next() {
+		result = append(result, e.Value.(*ownedItem))
+	}
+
+	return result
+}
+
+// Start starts every owned item that implements Starter
+//
+//	Params
+//	  ctx - passed to Starter.Start
+//
+//	Notes
+//		Items are started in dependency order: an item is started only after
+//		every item it depends on has started. Items that do not depend on each
+//		other are started in parallel
+//
+//		If any item fails to start, or panics (see PanicError), the items
+//		that were started are stopped in reverse order and the failures are
+//		returned
+//
+//		Items that are resolved after Start are started by the next call to
+//		Start
+func (d *ItemDiscovery) Start(ctx context.Context) error {
+	d.lifecycleLock.Lock()
+	defer d.lifecycleLock.Unlock()
+
+	owned := d.ownedItems()
+
+	var starters []*ownedItem
+	for _, o := range owned {
+		if _, ok := o.item.(Starter); ok && !o.started {
+			starters = append(starters, o)
+		}
+	}
+
+	if len(starters) == 0 {
+		return nil
+	}
+
+	deps := starterDependencies(owned, starters)
+
+	startCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var lock sync.Mutex
+	var errs []error
+	var started []*ownedItem
+
+	done := make(map[*ownedItem]chan struct{}, len(starters))
+	for _, o := range starters {
+		done[o] = make(chan struct{})
+	}
+
+	for _, o := range starters {
+		go func(o *ownedItem) {
+			defer close(done[o])
+
+			for _, dep := range deps[o] {
+				<-done[dep]
+			}
+
+			// nothing is started once a start has failed
+			if startCtx.Err() != nil {
+				return
+			}
+
+			err := startItem(startCtx, o)
+
+			lock.Lock()
+			defer lock.Unlock()
+
+			if err != nil {
+				errs = append(errs, err)
+				cancel()
+				return
+			}
+
+			started = append(started, o)
+		}(o)
+	}
+
+	for _, o := range starters {
+		<-done[o]
+	}
+
+	if len(errs) == 0 {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		// roll back in reverse order of start
+		for i := len(started) - 1; i >= 0; i-- {
+			if err := stopItem(ctx, started[i]); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		return stderrors.Join(errs...)
+	}
+
+	for _, o := range started {
+		o.started = true
+		d.started.PushBack(o)
+	}
+
+	return nil
+}
+
+// startItem starts an owned item, converting a panic into
+// ErrItemStartFailed so that the items that were started are rolled back
+func startItem(ctx context.Context, o *ownedItem) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			panicErr := &PanicError{Op: "start", Key: o.key, Value: p, Stack: debug.Stack()}
+			err = ErrItemStartFailed.Instance(o.key, panicErr).WithInner(panicErr)
+		}
+	}()
+
+	if err := o.item.(Starter).Start(ctx); err != nil {
+		return ErrItemStartFailed.Instance(o.key, err).WithInner(err)
+	}
+
+	return nil
+}
+
+// Stop stops the items started by Start, in the reverse order of start
+//
+//	Notes
+//		Items that implement Starter but not Stopper are considered stopped
+//
+//		Stop does not stop at the first failure. Every failure is reported in
+//		the returned error
+func (d *ItemDiscovery) Stop(ctx context.Context) error {
+	d.lifecycleLock.Lock()
+	defer d.lifecycleLock.Unlock()
+
+	return d.stop(ctx)
+}
+
+// stop stops the started items, lifecycleLock must be held
+func (d *ItemDiscovery) stop(ctx context.Context) error {
+	var errs []error
+
+	for e := d.started.Back(); e != nil; e = e.Prev() {
+		if err := stopItem(ctx, e.Value.(*ownedItem)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	d.started.Init()
+
+	return stderrors.Join(errs...)
+}
+
+// stopItem stops a started item
+func stopItem(ctx context.Context, o *ownedItem) error {
+	o.started = false
+
+	stopper, ok := o.item.(Stopper)
+	if !ok {
+		return nil
+	}
+
+	o.stopped = true
+
+	if err := callWithContext(ctx, func() error { return stopper.Stop(ctx) }); err != nil {
+		return ErrItemStopFailed.Instance(o.key, err).WithInner(err)
+	}
+
+	return nil
+}
+
+// starterDependencies returns, for each starter, the starters it depends on
+// either directly or through items that are not starters
+func starterDependencies(owned []*ownedItem, starters []*ownedItem) map[*ownedItem][]*ownedItem {
+	byKey := make(map[ItemKey]*ownedItem, len(owned))
+	for _, o := range owned {
+		byKey[o.key] = o
+	}
+
+	isStarter := make(map[*ownedItem]bool, len(starters))
+	for _, o := range starters {
+		isStarter[o] = true
+	}
+
+	result := make(map[*ownedItem][]*ownedItem, len(starters))
+
+	for _, starter := range starters {
+		visited := map[*ownedItem]bool{starter: true}
+		pending := append([]ItemKey(nil), starter.deps...)
+
+		for len(pending) > 0 {
+			key := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+
+			dep, ok := byKey[key]
+			if !ok || visited[dep] {
+				continue
+			}
+			visited[dep] = true
+
+			if isStarter[dep] {
+				result[starter] = append(result[starter], dep)
+			}
+
+			pending = append(pending, dep.deps...)
+		}
+	}
+
+	return result
+}
+
+// Close shuts down discovery without a deadline (see Shutdown)
+func (d *ItemDiscovery) Close() error {
+	return d.Shutdown(context.Background())
+}
+
+// Shutdown stops or closes every item owned by discovery in the reverse
+// order of creation, and removes them from discovery
+//
+//	Params
+//	  ctx - bounds the time allowed for shutdown
+//
+//	Notes
+//		Owned items are the items created by resolution and items added via
+//		AddOwnedItem. Items that implement Stopper are stopped, otherwise items
+//		that implement io.Closer are closed. Items that were started by Start
+//		are stopped first (see Stop)
+//
+//		Shutdown does not stop at the first failure. Every failure, including
+//		items that were not closed because ctx expired, is reported in the
+//		returned error
+//
+//		Items of a sealed discovery are closed, but not removed (see
+//		FreezeWithOptions)
+//
+//		Discovery also stops observing the resolvers of its items for evicted
+//		mappings (see MoEvict) until items are resolved again
+func (d *ItemDiscovery) Shutdown(ctx context.Context) error {
+	d.lifecycleLock.Lock()
+	defer d.lifecycleLock.Unlock()
+
+	// started items are stopped first, in the reverse order of start
+	errs := []error{d.stop(ctx)}
+
+	d.ownedLock.Lock()
+	owned := d.owned
+	d.owned = &list.List{}
+	observed := d.observed
+	d.observed = map[observableResolver]struct{}{}
+	d.ownedLock.Unlock()
+
+	for r := range observed {
+		r.unobserve(d)
+	}
+
+	for e := owned.Back(); e != nil; e = e.Prev() {
+		owned := e.Value.(*ownedItem)
+
+		d.evict(owned.key, owned.item)
+
+		if owned.stopped {
+			continue
+		}
+
+		if err := closeItem(ctx, owned.item); err != nil {
+			errs = append(errs, ErrItemCloseFailed.Instance(owned.key, err).WithInner(err))
+		}
+	}
+
+	return stderrors.Join(errs...)
+}
+
+// evict removes key from discovery if it still refers to item, and returns
+// true if it did. Items of a sealed discovery are never evicted
+func (d *ItemDiscovery) evict(key ItemKey, item interface{}) bool {
+	d.lock.Lock()
+
+	if d.sealed() {
+		d.lock.Unlock()
+		return false
+	}
+
+	current, evicted := d.items.get(key)
+	if evicted = evicted && sameItem(current, item); evicted {
+		d.items.delete(key)
+		delete(d.sources, key)
+		d.queueEvent(ItemRemoved, key, item)
+	}
+
+	d.lock.Unlock()
+
+	d.dispatchEvents()
+
+	return evicted
+}
+
+// observe registers discovery for notification of the mappings removed from
+// resolver, if resolver supports it
+func (d *ItemDiscovery) observe(resolver ItemResolver) {
+	r, ok := resolver.(observableResolver)
+	if !ok {
+		return
+	}
+
+	d.ownedLock.Lock()
+	defer d.ownedLock.Unlock()
+
+	if _, ok := d.observed[r]; !ok {
+		d.observed[r] = struct{}{}
+		r.observe(d)
+	}
+}
+
+// EvictionFailed is called with the failures to stop or close items that
+// are evicted because their mapping was removed (see MoEvict). The default
+// logs the failure via the standard logger
+//
+//	Notes
+//		EvictionFailed is not synchronized, assign it before mappings are
+//		removed
+var EvictionFailed = func(err error) {
+	log.Print(err)
+}
+
+// superHost is implemented by discoveries that evict the items of their
+// super discoveries that depend on the items they evict
+type superHost interface {
+	addSuper(d *ItemDiscovery)
+}
+
+// addSuper registers d as a super discovery of discovery
+//
+//	Notes
+//		Super discoveries are registered weakly, since they are typically
+//		dropped without being shut down (e.g. per request super discoveries)
+func (d *ItemDiscovery) addSuper(super *ItemDiscovery) {
+	d.superLock.Lock()
+	defer d.superLock.Unlock()
+
+	d.supers.add(super)
+}
+
+// mappingsRemoved evicts the resolved items that match, and the items that
+// depend on them (see evictItems)
+func (d *ItemDiscovery) mappingsRemoved(match func(key ItemKey) bool) {
+	d.evictItems(match, nil)
+}
+
+// evictItems evicts the resolved items that match, or that depend on an
+// evicted item, and stops or closes them in the reverse order of creation,
+// since nothing refers to them once they are evicted
+//
+//	Notes
+//		inherited are the keys of the items evicted by the base discoveries.
+//		They are dependencies of discovery unless it has its own item for the
+//		key
+//
+//		The super discoveries evict the items that depend on the evicted
+//		items before they are stopped or closed
+func (d *ItemDiscovery) evictItems(match func(key ItemKey) bool, inherited map[ItemKey]bool) {
+	evicted := map[ItemKey]bool{}
+
+	dependsOnEvicted := func(o *ownedItem) bool {
+		for _, dep := range o.deps {
+			if evicted[dep] {
+				return true
+			}
+			if _, own := d.items.get(dep); inherited[dep] && !own {
+				return true
+			}
+		}
+		return false
+	}
+
+	// dependencies are created before the items that use them, so evicted
+	// items are known before their dependents are checked
+	var released []*ownedItem
+	for _, o := range d.ownedItems() {
+		if !o.resolved || (!match(o.key) && !dependsOnEvicted(o)) || !d.evict(o.key, o.item) {
+			continue
+		}
+
+		evicted[o.key] = true
+		released = append(released, o)
+	}
+
+	if len(evicted) == 0 {
+		return
+	}
+
+	d.superLock.Lock()
+	supers := d.supers.live()
+	d.superLock.Unlock()
+
+	// items that discovery inherited are inherited by its supers as well
+	for key := range inherited {
+		if _, own := d.items.get(key); !own {
+			evicted[key] = true
+		}
+	}
+
+	for _, super := range supers {
+		super.evictItems(func(ItemKey) bool { return false }, evicted)
+	}
+
+	for i := len(released) - 1; i >= 0; i-- {
+		d.disownItem(released[i])
+
+		if err := d.release(context.Background(), released[i]); err != nil {
+			EvictionFailed(err)
+		}
+	}
+}
+
+// release stops an owned item if it was started, or closes it otherwise
+func (d *ItemDiscovery) release(ctx context.Context, o *ownedItem) error {
+	d.lifecycleLock.Lock()
+	defer d.lifecycleLock.Unlock()
+
+	var errs []error
+
+	if o.started {
+		for e := d.started.Front(); e != nil; e = e.Next() {
+			if e.Value.(*ownedItem) == o {
+				d.started.Remove(e)
+				break
+			}
+		}
+
+		errs = append(errs, stopItem(ctx, o))
+	}
+
+	if !o.stopped {
+		if err := closeItem(ctx, o.item); err != nil {
+			errs = append(errs, ErrItemCloseFailed.Instance(o.key, err).WithInner(err))
+		}
+	}
+
+	return stderrors.Join(errs...)
+}
+
+// closeItem stops or closes item, giving up when ctx is done
+func closeItem(ctx context.Context, item interface{}) error {
+	var closeFn func() error
+
+	switch c := item.(type) {
+	case Stopper:
+		closeFn = func() error { return c.Stop(ctx) }
+	case io.Closer:
+		closeFn = c.Close
+	default:
+		return nil
+	}
+
+	return callWithContext(ctx, closeFn)
+}
+
+// callWithContext calls fn, giving up (but not interrupting fn) when ctx is
+// done
+func callWithContext(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// sameItem compares items without panicking on uncomparable types
+func sameItem(a, b interface{}) bool {
+	if (a == nil) || (b == nil) {
+		return a == b
+	}
+
+	if !reflect.TypeOf(a).Comparable() {
+		return false
+	}
+
+	return a == b
+}
@@ -0,0 +1,242 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lifecycleLog records the order of lifecycle calls across items
+type lifecycleLog struct {
+	lock    sync.Mutex
+	entries []string
+}
+
+func (l *lifecycleLog) add(entry string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.entries = append(l.entries, entry)
+}
+
+func (l *lifecycleLog) get() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]string(nil), l.entries...)
+}
+
+type closerItem struct {
+	name string
+	log  *lifecycleLog
+	err  error
+}
+
+func (c *closerItem) Close() error {
+	c.log.add("close " + c.name)
+	return c.err
+}
+
+type stopperItem struct {
+	name  string
+	log   *lifecycleLog
+	delay time.Duration
+}
+
+func (s *stopperItem) Stop(ctx context.Context) error {
+	time.Sleep(s.delay)
+	s.log.add("stop " + s.name)
+	return nil
+}
+
+type lifecycleA interface{}
+type lifecycleB interface{}
+type lifecycleC interface{}
+
+var lifecycleAType = reflect.TypeOf((*lifecycleA)(nil)).Elem()
+var lifecycleBType = reflect.TypeOf((*lifecycleB)(nil)).Elem()
+var lifecycleCType = reflect.TypeOf((*lifecycleC)(nil)).Elem()
+
+func TestShutdown(t *testing.T) {
+	log := &lifecycleLog{}
+
+	resolver := NewBaseItemResolver()
+	resolver.AddMappingsVar(
+		ResolverMapping{
+			Type: lifecycleAType,
+			Creator: func(d Discovery) (interface{}, error) {
+				return &closerItem{name: "a", log: log}, nil
+			},
+		},
+		ResolverMapping{
+			Type: lifecycleBType,
+			Creator: func(d Discovery) (interface{}, error) {
+				// b depends on a
+				d.GetRequiredItem(lifecycleAType)
+				return &stopperItem{name: "b", log: log}, nil
+			},
+		})
+
+	d := NewItemDiscovery(resolver)
+
+	assert.NoError(t, d.AddItem(lifecycleCType, &closerItem{name: "not-owned", log: log}))
+	assert.NoError(t, d.AddOwnedItem(NamedKey(lifecycleCType, "owned"), &closerItem{name: "owned", log: log}))
+
+	d.GetRequiredItem(lifecycleBType)
+
+	assert.NoError(t, d.Shutdown(context.Background()))
+	assert.Equal(t, []string{"stop b", "close a", "close owned"}, log.get())
+
+	// owned items are removed, other items are not
+	assert.False(t, d.HasItem(lifecycleAType))
+	assert.False(t, d.HasItem(lifecycleBType))
+	assert.True(t, d.HasItem(lifecycleCType))
+}
+
+func TestShutdownCollectsErrors(t *testing.T) {
+	log := &lifecycleLog{}
+	d := NewItemDiscovery(nil)
+
+	errC := errors.New("c failed")
+	assert.NoError(t, d.AddOwnedItem(TypeKey(lifecycleAType), &closerItem{name: "a", log: log}))
+	assert.NoError(t, d.AddOwnedItem(TypeKey(lifecycleBType), &stopperItem{name: "b", log: log, delay: time.Second}))
+	assert.NoError(t, d.AddOwnedItem(TypeKey(lifecycleCType), &closerItem{name: "c", log: log, err: errC}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// c fails, b exceeds the deadline and a is never closed
+	err := d.Shutdown(ctx)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "c failed")
+	assert.Contains(t, err.Error(), context.DeadlineExceeded.Error())
+	assert.Equal(t, []string{"close c"}, log.get())
+	assert.Equal(t, 0, d.owned.Len())
+}
+
+type serviceItem struct {
+	name       string
+	log        *lifecycleLog
+	startErr   error
+	startPanic interface{}
+	delay      time.Duration
+}
+
+func (s *serviceItem) Start(ctx context.Context) error {
+	time.Sleep(s.delay)
+	if s.startPanic != nil {
+		panic(s.startPanic)
+	}
+	if s.startErr != nil {
+		return s.startErr
+	}
+	s.log.add("start " + s.name)
+	return nil
+}
+
+func (s *serviceItem) Stop(ctx context.Context) error {
+	s.log.add("stop " + s.name)
+	return nil
+}
+
+func newServiceResolver(log *lifecycleLog, startErr error) ItemResolver {
+	resolver := NewBaseItemResolver()
+	resolver.AddMappingsVar(
+		ResolverMapping{
+			Type: lifecycleAType,
+			Creator: func(d Discovery) (interface{}, error) {
+				return &serviceItem{name: "a", log: log, delay: 20 * time.Millisecond}, nil
+			},
+		},
+		ResolverMapping{
+			Type: lifecycleBType,
+			Creator: func(d Discovery) (interface{}, error) {
+				// b depends on a
+				d.GetRequiredItem(lifecycleAType)
+				return &serviceItem{name: "b", log: log, startErr: startErr}, nil
+			},
+		},
+		ResolverMapping{
+			Type: lifecycleCType,
+			Creator: func(d Discovery) (interface{}, error) {
+				return &serviceItem{name: "c", log: log, delay: 50 * time.Millisecond}, nil
+			},
+		})
+
+	return resolver
+}
+
+func TestStartStop(t *testing.T) {
+	log := &lifecycleLog{}
+	d := NewItemDiscovery(newServiceResolver(log, nil))
+
+	d.GetRequiredItem(lifecycleBType)
+	d.GetRequiredItem(lifecycleCType)
+
+	assert.NoError(t, d.Start(context.Background()))
+
+	// c is independent, so it starts in parallel with a and b
+	assert.Equal(t, []string{"start a", "start b", "start c"}, log.get())
+
+	// starting again does not restart anything
+	assert.NoError(t, d.Start(context.Background()))
+	assert.Len(t, log.get(), 3)
+
+	assert.NoError(t, d.Stop(context.Background()))
+	assert.Equal(t, []string{"stop c", "stop b", "stop a"}, log.get()[3:])
+
+	// stopped items are not stopped again by Shutdown
+	assert.NoError(t, d.Shutdown(context.Background()))
+	assert.Len(t, log.get(), 6)
+}
+
+func TestStartRollback(t *testing.T) {
+	log := &lifecycleLog{}
+	errB := errors.New("b failed")
+	d := NewItemDiscovery(newServiceResolver(log, errB))
+
+	d.GetRequiredItem(lifecycleBType)
+	d.GetRequiredItem(lifecycleCType)
+
+	err := d.Start(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "b failed")
+
+	entries := log.get()
+	assert.Contains(t, entries, "stop a")
+	assert.NotContains(t, entries, "start b")
+	assert.Equal(t, 0, d.started.Len())
+}
+
+func TestStartPanics(t *testing.T) {
+	log := &lifecycleLog{}
+	resolver := newServiceResolver(log, nil).(*BaseItemResolver)
+	resolver.ReplaceMapping(ResolverMapping{
+		Type: lifecycleBType,
+		Creator: func(d Discovery) (interface{}, error) {
+			d.GetRequiredItem(lifecycleAType)
+			return &serviceItem{name: "b", log: log, startPanic: "b panicked"}, nil
+		},
+	}, MoNone)
+
+	d := NewItemDiscovery(resolver)
+	d.GetRequiredItem(lifecycleBType)
+
+	var err error
+	assert.NotPanics(t, func() { err = d.Start(context.Background()) })
+	assert.Contains(t, err.Error(), "start panicked: b panicked")
+
+	var panicErr *PanicError
+	if assert.ErrorAs(t, err, &panicErr) {
+		assert.Equal(t, "b panicked", panicErr.Value)
+		assert.Equal(t, TypeKey(lifecycleBType), panicErr.Key)
+		assert.NotEmpty(t, panicErr.Stack)
+	}
+
+	// the items that were started are rolled back
+	assert.Contains(t, log.get(), "stop a")
+	assert.Equal(t, 0, d.started.Len())
+}
@@ -0,0 +1,58 @@
+package discovery
+
+// Lifetime declares how the items created by a ResolverMapping are shared
+type Lifetime int
+
+const (
+	// LtDefault leaves sharing to the caller: the item is shared unless the
+	// caller specifies RoInstanceItem
+	LtDefault Lifetime = iota
+	// LtSingleton indicates that one item is created and shared by every
+	// caller of the discovery that owns the mapping, including super discoveries
+	LtSingleton
+	// LtTransient indicates that a new item is created for every caller and
+	// never cached
+	LtTransient
+	// LtScoped indicates that one item is created and shared per Discovery.
+	// A super discovery resolves its own item, even if the mapping belongs to
+	// its base discovery
+	LtScoped
+)
+
+// String returns the name of the lifetime
+func (lt Lifetime) String() string {
+	switch lt {
+	case LtDefault:
+		return "default"
+	case LtSingleton:
+		return "singleton"
+	case LtTransient:
+		return "transient"
+	case LtScoped:
+		return "scoped"
+	}
+
+	return "unknown"
+}
+
+// applyTo enforces the lifetime on the resolve options of a caller
+//
+//	Notes
+//		The name of an option that cannot be honored without breaking the
+//		lifetime is returned as conflict, which callers report as a
+//		*LifetimeError (ErrLifetimeConflict)
+func (lt Lifetime) applyTo(options ResolveOptions) (result ResolveOptions, conflict string) {
+	switch lt {
+	case LtSingleton, LtScoped:
+		if (options & RoInstanceItem) != 0 {
+			return options, "RoInstanceItem"
+		}
+	case LtTransient:
+		if (options & RoDontResolve) != 0 {
+			return options, "RoDontResolve"
+		}
+		options |= RoInstanceItem
+	}
+
+	return options, ""
+}
@@ -0,0 +1,477 @@
+package discovery
+
+import (
+	stderrors "errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Module groups the mappings and items of a feature, along with the modules
+// it requires
+//
+//	Notes
+//		Name is required, and identifies the module within a discovery
+//
+//		Modules are installed after the modules they require (see Install)
+type Module struct {
+	Name       string
+	Mappings   []ResolverMapping
+	AOMappings []AOResolverMapping
+	Items      []ModuleItem
+	Requires   []*Module
+}
+
+// ModuleItem is an item added to discovery by a Module
+type ModuleItem struct {
+	Key  ItemKey
+	Item interface{}
+}
+
+// moduleHost is implemented by discoveries that modules can be installed in
+type moduleHost interface {
+	installModule(m *Module, source string) error
+}
+
+var _ moduleHost = &ItemDiscovery{}
+
+// Install installs modules, and the modules they require, in d
+//
+//	Params
+//	  d - optional Discovery, default discovery is used (and created) if nil
+//	  modules - the modules to install
+//
+//	Notes
+//		Modules are installed in dependency order: a module is installed only
+//		after every module it requires. Modules that are already installed
+//		in d are skipped, so modules can be required by several modules
+//
+//		A module with the same name as an installed module, or with a mapping
+//		or item that an installed module already provides, is rejected with
+//		ErrModuleConflict. Other conflicts are subject to the conflict policy
+//		of d and its resolver (see ConflictPolicy)
+//
+//		Installation stops at the first module that fails, which is not
+//		installed at all. The modules that were installed before it remain
+//		installed
+func Install(d Discovery, modules ...*Module) error {
+	if d == nil {
+		d = GetOrCreateDefaultDiscovery(nil)
+	}
+
+	host, ok := d.(moduleHost)
+	if !ok {
+		return ErrModuleInstallFailed.Instance(moduleNames(modules), fmt.Sprintf("%T does not support modules", d))
+	}
+
+	ordered, err := orderModules(modules)
+	if err != nil {
+		return err
+	}
+
+	source := callerSource()
+	for _, m := range ordered {
+		if err := host.installModule(m, source); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// orderModules returns modules, and the modules they require, in the order
+// they must be installed
+func orderModules(modules []*Module) ([]*Module, error) {
+	var ordered []*Module
+
+	visited := map[*Module]bool{}
+	var visiting []*Module
+
+	var visit func(m *Module) error
+	visit = func(m *Module) error {
+		if visited[m] {
+			return nil
+		}
+
+		for i, v := range visiting {
+			if v == m {
+				names := moduleNames(append(append([]*Module(nil), visiting[i:]...), m))
+				return ErrModuleCycle.Instance(m.Name, strings.ReplaceAll(names, ", ", " -> "))
+			}
+		}
+
+		visiting = append(visiting, m)
+		for _, required := range m.Requires {
+			if err := visit(required); err != nil {
+				return err
+			}
+		}
+		visiting = visiting[:len(visiting)-1]
+
+		visited[m] = true
+		ordered = append(ordered, m)
+
+		return nil
+	}
+
+	for _, m := range modules {
+		if err := visit(m); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+// moduleNames returns the names of modules as a comma separated list
+func moduleNames(modules []*Module) string {
+	names := make([]string, len(modules))
+	for i, m := range modules {
+		names[i] = m.Name
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// sourcedResolver is implemented by resolvers that record where mappings
+// were registered (see BaseItemResolver.TryAddMappings)
+type sourcedResolver interface {
+	tryAddMappings(mappings []ResolverMapping, source string) ([]ItemKey, error)
+}
+
+// installModule installs m, unless it is already installed
+func (d *ItemDiscovery) installModule(m *Module, source string) error {
+	if m.Name == "" {
+		return ErrModuleInstallFailed.Instance(m.Name, "a module name is required")
+	}
+
+	// installs are serialized, so conflicts between modules are detected
+	// before anything is added
+	d.moduleLock.Lock()
+	defer d.moduleLock.Unlock()
+
+	for _, installed := range d.modules {
+		if installed == m {
+			return nil
+		}
+		if installed.Name == m.Name {
+			return ErrModuleConflict.Instance(m.Name, installed.Name, "a module with the same name is installed")
+		}
+	}
+
+	keys := make([]ItemKey, 0, len(m.Mappings)+len(m.Items))
+	for _, mapping := range m.Mappings {
+		keys = append(keys, mapping.Key())
+	}
+	for _, item := range m.Items {
+		keys = append(keys, item.Key)
+	}
+
+	for _, key := range keys {
+		if owner, ok := d.moduleOf[key]; ok {
+			return ErrModuleConflict.Instance(m.Name, owner.Name, fmt.Sprintf("%s is already provided", key))
+		}
+	}
+
+	stored, err := d.addModule(m, fmt.Sprintf("module %s (%s)", m.Name, source))
+	if err != nil {
+		return ErrModuleInstallFailed.Instance(m.Name, err).WithInner(err)
+	}
+
+	// keys that the conflict policy kept for earlier registrations are not
+	// provided by m
+	for _, key := range stored {
+		d.moduleOf[key] = m
+	}
+	d.modules = append(d.modules, m)
+
+	return nil
+}
+
+// tryResolver is implemented by resolvers that return an error for
+// rejected changes (see BaseItemResolver.TryReplaceMapping)
+type tryResolver interface {
+	TryRemoveMapping(key ItemKey, options MappingOptions) (bool, error)
+	TryReplaceMapping(mapping ResolverMapping, options MappingOptions) (bool, error)
+	TryAddAOMappings(mappings []AOResolverMapping) error
+	TryRemoveAOMapping(itemType reflect.Type, options MappingOptions) (bool, error)
+}
+
+// addModule adds the mappings and items of m to discovery, and returns the
+// keys of the mappings and items that were stored
+//
+//	Notes
+//		m is added entirely or not at all: m is checked before anything is
+//		added (see checkModule). If a change made concurrently still rejects
+//		a part of m, the mappings that were added are rolled back (see
+//		rollbackModule)
+func (d *ItemDiscovery) addModule(m *Module, source string) ([]ItemKey, error) {
+	var ao AOItemResolver
+	if len(m.AOMappings) > 0 {
+		var ok bool
+		if ao, ok = d.resolver.(AOItemResolver); !ok {
+			return nil, fmt.Errorf("resolver %T does not support ao mappings", d.resolver)
+		}
+	}
+
+	if err := d.checkModule(m, source); err != nil {
+		return nil, err
+	}
+
+	previous := map[ItemKey]ResolverMapping{}
+	for _, mapping := range m.Mappings {
+		if existing, ok := d.resolver.GetKeyedMapping(mapping.Key()); ok {
+			previous[mapping.Key()] = existing
+		}
+	}
+
+	var stored []ItemKey
+	if r, ok := d.resolver.(sourcedResolver); ok {
+		var err error
+		if stored, err = r.tryAddMappings(m.Mappings, source); err != nil {
+			return nil, err
+		}
+	} else {
+		d.resolver.AddMappings(m.Mappings)
+		for _, mapping := range m.Mappings {
+			stored = append(stored, mapping.Key())
+		}
+	}
+
+	var previousAO map[reflect.Type][]AOResolverMapping
+	if len(m.AOMappings) > 0 {
+		previousAO = map[reflect.Type][]AOResolverMapping{}
+		for _, mapping := range m.AOMappings {
+			existing, _ := ao.GetAOMappings(mapping.Type)
+			previousAO[mapping.Type] = existing
+		}
+
+		if r, ok := ao.(tryResolver); ok {
+			if err := r.TryAddAOMappings(m.AOMappings); err != nil {
+				return nil, d.rollbackModule(stored, previous, nil, err)
+			}
+		} else {
+			ao.AddAOMappings(m.AOMappings)
+		}
+	}
+
+	items, err := d.addItems(m.Items, source)
+	if err != nil {
+		return nil, d.rollbackModule(stored, previous, previousAO, err)
+	}
+
+	return append(stored, items...), nil
+}
+
+// checkModule returns an error if discovery or its resolver would reject a
+// part of m, without adding anything
+func (d *ItemDiscovery) checkModule(m *Module, source string) error {
+	if r, ok := d.resolver.(freezable); ok && r.IsFrozen() {
+		if len(m.Mappings) > 0 {
+			return newFrozenError("add mapping", m.Mappings[0].Key())
+		}
+		if len(m.AOMappings) > 0 {
+			return newFrozenError("add ao mapping", TypeKey(m.AOMappings[0].Type))
+		}
+	}
+
+	if err := d.checkItems(m.Items); err != nil {
+		return err
+	}
+
+	if ConflictPolicy(d.conflicts.Load()) != CpError {
+		return nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	var errs []error
+
+	pending := map[ItemKey]bool{}
+	for _, item := range m.Items {
+		if _, exists := d.items.get(item.Key); exists || pending[item.Key] {
+			existing, ok := d.sources[item.Key]
+			if !ok {
+				existing = resolvedSource
+			}
+			if pending[item.Key] {
+				existing = source
+			}
+
+			errs = append(errs, newDuplicateError("item", item.Key, source, existing))
+		}
+
+		pending[item.Key] = true
+	}
+
+	return stderrors.Join(errs...)
+}
+
+// rollbackModule removes the stored mappings of a module, restores the
+// mappings and ao mappings that they replaced, and returns cause along with
+// the failures of the rollback
+//
+//	Notes
+//		The mappings were visible while the module was added, so the items
+//		cached for their keys are evicted (see MoEvict), and are resolved
+//		again with the restored mappings
+func (d *ItemDiscovery) rollbackModule(stored []ItemKey, previous map[ItemKey]ResolverMapping, previousAO map[reflect.Type][]AOResolverMapping, cause error) error {
+	errs := []error{cause}
+
+	r, ok := d.resolver.(tryResolver)
+	if !ok {
+		r = panicResolver{d.resolver}
+	}
+
+	for _, key := range stored {
+		var err error
+		if existing, ok := previous[key]; ok {
+			_, err = r.TryReplaceMapping(existing, MoEvict)
+		} else {
+			_, err = r.TryRemoveMapping(key, MoEvict)
+		}
+		errs = append(errs, err)
+	}
+
+	for itemType, existing := range previousAO {
+		_, err := r.TryRemoveAOMapping(itemType, MoEvict)
+		if (err == nil) && (len(existing) > 0) {
+			err = r.TryAddAOMappings(existing)
+		}
+		errs = append(errs, err)
+	}
+
+	return stderrors.Join(errs...)
+}
+
+// panicResolver adapts a resolver without Try variants to tryResolver, the
+// changes it rejects panic
+type panicResolver struct {
+	ItemResolver
+}
+
+func (r panicResolver) TryRemoveMapping(key ItemKey, options MappingOptions) (bool, error) {
+	return r.RemoveMapping(key, options), nil
+}
+
+func (r panicResolver) TryReplaceMapping(mapping ResolverMapping, options MappingOptions) (bool, error) {
+	return r.ReplaceMapping(mapping, options), nil
+}
+
+func (r panicResolver) TryAddAOMappings(mappings []AOResolverMapping) error {
+	r.ItemResolver.(AOItemResolver).AddAOMappings(mappings)
+	return nil
+}
+
+func (r panicResolver) TryRemoveAOMapping(itemType reflect.Type, options MappingOptions) (bool, error) {
+	return r.ItemResolver.(AOItemResolver).RemoveAOMapping(itemType, options), nil
+}
+
+// checkItems returns an error if discovery rejects any of items, without
+// adding them
+func (d *ItemDiscovery) checkItems(items []ModuleItem) error {
+	strict := d.strict.Load()
+	for _, item := range items {
+		if !isItemType(item.Key.Type, item.Item, strict) {
+			return newItemTypeError(errorContext(d, item.Key), item.Key.Type, item.Item, "")
+		}
+	}
+
+	if (len(items) > 0) && (d.frozen.Load() != notFrozen) {
+		return newFrozenError("add item", items[0].Key)
+	}
+
+	return nil
+}
+
+// addItems adds items registered at source according to the conflict
+// policy, and returns the keys of the items that were stored
+//
+//	Notes
+//		Items are added together: if any item is rejected, none are added and
+//		every conflict is returned
+func (d *ItemDiscovery) addItems(items []ModuleItem, source string) ([]ItemKey, error) {
+	if err := d.checkItems(items); (err != nil) || (len(items) == 0) {
+		return nil, err
+	}
+
+	d.lock.Lock()
+
+	if d.frozen.Load() != notFrozen {
+		d.lock.Unlock()
+		return nil, newFrozenError("add item", items[0].Key)
+	}
+
+	policy := ConflictPolicy(d.conflicts.Load())
+
+	var add []ModuleItem
+	var errs []error
+
+	pending := map[ItemKey]bool{}
+	for _, item := range items {
+		if _, exists := d.items.get(item.Key); exists || pending[item.Key] {
+			existing, ok := d.sources[item.Key]
+			if !ok {
+				existing = resolvedSource
+			}
+			if pending[item.Key] {
+				existing = source
+			}
+
+			store, err := policy.apply("item", item.Key, source, existing)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if !store {
+				continue
+			}
+		}
+
+		pending[item.Key] = true
+		add = append(add, item)
+	}
+
+	if len(errs) > 0 {
+		d.lock.Unlock()
+		return nil, stderrors.Join(errs...)
+	}
+
+	stored := make([]ItemKey, 0, len(add))
+	for _, item := range add {
+		kind := ItemAdded
+		if _, ok := d.items.get(item.Key); ok {
+			kind = ItemReplaced
+		}
+
+		d.items.set(item.Key, item.Item)
+		d.sources[item.Key] = source
+		d.queueEvent(kind, item.Key, item.Item)
+		stored = append(stored, item.Key)
+	}
+
+	d.lock.Unlock()
+
+	d.dispatchEvents()
+
+	return stored, nil
+}
+
+// Modules returns the modules installed in discovery, in the order they were
+// installed
+func (d *ItemDiscovery) Modules() []*Module {
+	d.moduleLock.Lock()
+	defer d.moduleLock.Unlock()
+
+	return append([]*Module(nil), d.modules...)
+}
+
+// ModuleOf returns the installed module that contributed the mapping or item
+// for key, if any
+func (d *ItemDiscovery) ModuleOf(key ItemKey) (*Module, bool) {
+	d.moduleLock.Lock()
+	defer d.moduleLock.Unlock()
+
+	m, ok := d.moduleOf[key]
+	return m, ok
+}
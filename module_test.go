@@ -0,0 +1,211 @@
+package discovery
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstallModules(t *testing.T) {
+	storage := &Module{
+		Name:     "storage",
+		Mappings: []ResolverMapping{versionMapping(1)},
+	}
+	config := &Module{
+		Name:  "config",
+		Items: []ModuleItem{{Key: NamedKey(TypeOf[string](), "env"), Item: "test"}},
+	}
+	service := &Module{
+		Name:     "service",
+		Mappings: []ResolverMapping{{Type: testItemType, Creator: dependsOn(versionedType)}},
+		AOMappings: []AOResolverMapping{{
+			Type: versionedType,
+			Creator: func(d Discovery, item interface{}) (interface{}, error) {
+				return &versionedItem{version: item.(*versionedItem).version + 10}, nil
+			}}},
+		Requires: []*Module{storage, config},
+	}
+
+	d := NewItemDiscovery(nil)
+	assert.NoError(t, Install(d, service))
+
+	// required modules are installed first
+	assert.Equal(t, []*Module{storage, config, service}, d.Modules())
+
+	m, ok := d.ModuleOf(TypeKey(versionedType))
+	assert.True(t, ok)
+	assert.Same(t, storage, m)
+
+	m, ok = d.ModuleOf(NamedKey(TypeOf[string](), "env"))
+	assert.True(t, ok)
+	assert.Same(t, config, m)
+
+	_, ok = d.ModuleOf(TypeKey(TypeOf[int]()))
+	assert.False(t, ok)
+
+	_, err := d.GetItem(testItemType)
+	assert.NoError(t, err)
+
+	item, err := Get[*versionedItem](d)
+	assert.NoError(t, err)
+	assert.Equal(t, 11, item.version)
+
+	// installed modules are skipped
+	assert.NoError(t, Install(d, storage, service))
+	assert.Len(t, d.Modules(), 3)
+}
+
+func TestInstallModuleConflicts(t *testing.T) {
+	d := NewItemDiscovery(nil)
+	storage := &Module{Name: "storage", Mappings: []ResolverMapping{versionMapping(1)}}
+	assert.NoError(t, Install(d, storage))
+
+	err := Install(d, &Module{Name: "storage"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "same name")
+
+	err = Install(d, &Module{Name: "other", Mappings: []ResolverMapping{versionMapping(2)}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "'other' conflicts with module 'storage'")
+	assert.Contains(t, err.Error(), TypeKey(versionedType).String())
+
+	err = Install(d, &Module{})
+	assert.Error(t, err)
+
+	// conflicts with registrations outside of modules follow the policy,
+	// and name the module
+	resolver := NewBaseItemResolver()
+	resolver.SetConflictPolicy(CpError)
+	resolver.AddMapping(versionMapping(1))
+
+	err = Install(NewItemDiscovery(resolver), &Module{Name: "storage", Mappings: []ResolverMapping{versionMapping(2)}})
+	assert.ErrorIs(t, err, ErrDuplicate)
+
+	var dup *DuplicateError
+	if assert.ErrorAs(t, err, &dup) {
+		assert.Contains(t, dup.Source, "module storage (")
+		assert.Contains(t, dup.Source, "module_test.go:")
+	}
+}
+
+func TestInstallModuleCycle(t *testing.T) {
+	a := &Module{Name: "a"}
+	b := &Module{Name: "b", Requires: []*Module{a}}
+	a.Requires = []*Module{b}
+
+	d := NewItemDiscovery(nil)
+	err := Install(d, a)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "a -> b -> a")
+	assert.Empty(t, d.Modules())
+}
+
+func TestInstallModuleIsAtomic(t *testing.T) {
+	d := NewItemDiscovery(nil)
+
+	// an item that is rejected leaves the mappings of its module unchanged
+	err := Install(d, &Module{
+		Name:       "broken",
+		Mappings:   []ResolverMapping{versionMapping(1)},
+		AOMappings: []AOResolverMapping{{Type: versionedType, Creator: nil}},
+		Items:      []ModuleItem{{Key: TypeKey(MockServiceType), Item: "not a service"}},
+	})
+	assert.ErrorIs(t, err, ErrNotItemType)
+
+	_, ok := d.GetResolver().GetKeyedMapping(TypeKey(versionedType))
+	assert.False(t, ok)
+	_, ok = d.GetResolver().(AOItemResolver).GetAOMappings(versionedType)
+	assert.False(t, ok)
+	assert.Empty(t, d.Modules())
+
+	// a conflict is rejected before the mappings are added
+	d.SetConflictPolicy(CpError)
+	assert.NoError(t, d.AddKeyedItem(NamedKey(TypeOf[string](), "env"), "prod"))
+
+	err = Install(d, &Module{
+		Name:     "conflict",
+		Mappings: []ResolverMapping{{Type: testItemType, Creator: dependsOn()}},
+		Items:    []ModuleItem{{Key: NamedKey(TypeOf[string](), "env"), Item: "test"}},
+	})
+	assert.ErrorIs(t, err, ErrDuplicate)
+	_, ok = d.GetResolver().GetKeyedMapping(TypeKey(testItemType))
+	assert.False(t, ok)
+}
+
+// rejectingResolver rejects ao mappings, after resolving an item as a
+// concurrent caller would
+type rejectingResolver struct {
+	*BaseItemResolver
+	d *ItemDiscovery
+}
+
+func (r *rejectingResolver) TryAddAOMappings(mappings []AOResolverMapping) error {
+	r.d.GetRequiredItem(cycleAType)
+	return errors.New("ao mappings rejected")
+}
+
+func TestInstallModuleRollback(t *testing.T) {
+	log := &lifecycleLog{}
+
+	resolver := &rejectingResolver{BaseItemResolver: NewBaseItemResolver()}
+	resolver.AddMapping(versionMapping(1))
+	d := NewItemDiscovery(resolver)
+	resolver.d = d
+
+	err := Install(d, &Module{
+		Name: "rejected",
+		Mappings: []ResolverMapping{versionMapping(2), {
+			Type: cycleAType,
+			Creator: func(d Discovery) (interface{}, error) {
+				return &closerItem{name: "x", log: log}, nil
+			}}},
+		AOMappings: []AOResolverMapping{{Type: versionedType}},
+	})
+	assert.ErrorContains(t, err, "ao mappings rejected")
+	assert.Empty(t, d.Modules())
+
+	// the item resolved from the mappings of the module is evicted
+	assert.False(t, d.HasItem(cycleAType))
+	assert.Equal(t, []string{"close x"}, log.get())
+
+	_, ok := resolver.GetMapping(cycleAType)
+	assert.False(t, ok)
+	item, err := Get[*versionedItem](d)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, item.version)
+}
+
+func TestInstallModuleKeepFirst(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.SetConflictPolicy(CpKeepFirst)
+	resolver.AddMapping(versionMapping(1))
+
+	d := NewItemDiscovery(resolver)
+	m := &Module{Name: "m", Mappings: []ResolverMapping{versionMapping(2), {Type: testItemType, Creator: dependsOn()}}}
+	assert.NoError(t, Install(d, m))
+
+	// the mapping kept by the policy is not provided by m
+	_, ok := d.ModuleOf(TypeKey(versionedType))
+	assert.False(t, ok)
+
+	owner, ok := d.ModuleOf(TypeKey(testItemType))
+	assert.True(t, ok)
+	assert.Same(t, m, owner)
+}
+
+func TestInstallModuleFrozen(t *testing.T) {
+	d := NewItemDiscovery(nil)
+	d.Freeze()
+
+	// a module with only ao mappings is rejected by the frozen resolver
+	var err error
+	assert.NotPanics(t, func() {
+		err = Install(d, &Module{Name: "ao", AOMappings: []AOResolverMapping{{Type: versionedType}}})
+	})
+	assert.ErrorIs(t, err, ErrFrozen)
+	assert.Empty(t, d.Modules())
+
+	_, ok := d.ModuleOf(TypeKey(versionedType))
+	assert.False(t, ok)
+}
@@ -0,0 +1,253 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// PanicError is the inner error of the ErrItemNotResolved returned when a
+// Creator (or AO creator) panics, or of the ErrItemStartFailed returned when
+// Starter.Start panics
+//
+//	Notes
+//		Op is "start" for Starter.Start, and empty for creators
+//
+//		Path is the resolution path that led to the creator, and Stack is the
+//		stack of the goroutine at the time of the panic
+type PanicError struct {
+	Op    string
+	Key   ItemKey
+	Path  ResolvePath
+	Value interface{}
+	Stack []byte
+}
+
+// Error returns the panic value and resolution path
+func (e *PanicError) Error() string {
+	if e.Op != "" {
+		return fmt.Sprintf("%s panicked: %v (%s)", e.Op, e.Value, e.Key)
+	}
+
+	return fmt.Sprintf("creator panicked: %v (resolving %s)", e.Value, e.Path)
+}
+
+// Unwrap returns the panic value if it is an error
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+
+	return nil
+}
+
+// resolution is the Discovery handed to a Creator while an item is being
+// resolved
+//
+//	Notes
+//		Every item the Creator acquires through the resolution is recorded as
+//		a dependency of the item being resolved, and is acquired with the
+//		context of the resolution (see ResolveContext). Once the resolution completes,
+//		the resolution behaves exactly like the discovery it wraps, so creators
+//		that keep a reference to it do not record stale dependencies
+type resolution struct {
+	*ItemDiscovery
+
+	ctx    context.Context
+	key    ItemKey
+	parent *resolution
+	done   atomic.Bool
+
+	lock sync.Mutex
+	deps []ItemKey
+}
+
+// newResolution creates the resolution of key by d
+func newResolution(ctx context.Context, d *ItemDiscovery, key ItemKey, parent *resolution) *resolution {
+	return &resolution{
+		ItemDiscovery: d,
+		ctx:           ctx,
+		key:           key,
+		parent:        parent,
+	}
+}
+
+// ResolveContext returns the context of the resolution that d belongs to
+//
+//	Notes
+//		d is the Discovery passed to a Creator. The context is the context
+//		passed to GetItemContext (or a variant) that triggered the resolution,
+//		or context.Background() if there was none
+func ResolveContext(d Discovery) context.Context {
+	if r, ok := d.(*resolution); ok {
+		return r.ctx
+	}
+
+	return context.Background()
+}
+
+// path returns the keys of the resolution chain that ends with r
+func (r *resolution) path() ResolvePath {
+	var path ResolvePath
+	for cur := r; cur != nil; cur = cur.parent {
+		path = append(path, cur.key)
+	}
+
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+
+	return path
+}
+
+// pathFrom returns the keys of the resolution chain from ancestor to r,
+// including both
+func (r *resolution) pathFrom(ancestor *resolution) ResolvePath {
+	path := r.path()
+	return path[len(path)-r.depthFrom(ancestor)-1:]
+}
+
+// depthFrom returns the number of links between ancestor and r
+func (r *resolution) depthFrom(ancestor *resolution) int {
+	depth := 0
+	for cur := r; (cur != nil) && (cur != ancestor); cur = cur.parent {
+		depth++
+	}
+
+	return depth
+}
+
+// descendsFrom returns true if ancestor is r or one of its parents
+func (r *resolution) descendsFrom(ancestor *resolution) bool {
+	for cur := r; cur != nil; cur = cur.parent {
+		if cur == ancestor {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cyclePath returns the circular path if the item of r is already being
+// resolved by the same discovery in the chain of r, otherwise nil
+func (r *resolution) cyclePath() ResolvePath {
+	for cur := r.parent; cur != nil; cur = cur.parent {
+		if (cur.ItemDiscovery == r.ItemDiscovery) && (cur.key == r.key) {
+			return r.pathFrom(cur)
+		}
+	}
+
+	return nil
+}
+
+// create calls resolve on behalf of r, converting a panic into
+// ErrItemNotResolved so that the resolution is unwound normally
+func (r *resolution) create(resolve resolveFunc) (item interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			panicErr := &PanicError{Key: r.key, Path: r.path(), Value: p, Stack: debug.Stack()}
+			item = nil
+			err = newResolveError(errorContext(r, r.key), r.key, panicErr, "")
+		}
+	}()
+
+	return resolve(r)
+}
+
+// complete ends the resolution and returns the dependencies it recorded
+func (r *resolution) complete() []ItemKey {
+	r.done.Store(true)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.deps
+}
+
+// active returns r if the resolution is still in progress, otherwise nil
+func (r *resolution) active() *resolution {
+	if (r == nil) || r.done.Load() {
+		return nil
+	}
+
+	return r
+}
+
+func (r *resolution) addDependency(key ItemKey) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for _, dep := range r.deps {
+		if dep == key {
+			return
+		}
+	}
+
+	r.deps = append(r.deps, key)
+}
+
+// getItem acquires an item on behalf of the creator, recording the dependency
+func (r *resolution) getItem(ctx context.Context, key ItemKey, options ResolveOptions) (interface{}, error) {
+	parent := r.active()
+
+	item, err := r.ItemDiscovery._getTypedItem(ctx, key, options, parent)
+
+	if (err == nil) && (parent != nil) {
+		parent.addDependency(key)
+	}
+
+	return item, err
+}
+
+//	--------------------------------------------------------------------------
+//	Discovery implementation
+//	--------------------------------------------------------------------------
+
+func (r *resolution) GetItem(itemType reflect.Type) (interface{}, error) {
+	return r.getItem(r.ctx, TypeKey(itemType), RoNone)
+}
+
+func (r *resolution) GetRequiredItem(itemType reflect.Type) interface{} {
+	return r.GetRequiredKeyedItem(TypeKey(itemType))
+}
+
+func (r *resolution) GetItemWithOptions(itemType reflect.Type, options ResolveOptions) (interface{}, error) {
+	return r.getItem(r.ctx, TypeKey(itemType), options)
+}
+
+func (r *resolution) GetRequiredItemWithOptions(itemType reflect.Type, options ResolveOptions) (interface{}, error) {
+	return r.getItem(r.ctx, TypeKey(itemType), options)
+}
+
+func (r *resolution) GetKeyedItem(key ItemKey) (interface{}, error) {
+	return r.getItem(r.ctx, key, RoNone)
+}
+
+func (r *resolution) GetRequiredKeyedItem(key ItemKey) interface{} {
+	item, err := r.getItem(r.ctx, key, RoNone)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return item
+}
+
+func (r *resolution) GetKeyedItemWithOptions(key ItemKey, options ResolveOptions) (interface{}, error) {
+	return r.getItem(r.ctx, key, options)
+}
+
+func (r *resolution) GetItemContext(ctx context.Context, itemType reflect.Type) (interface{}, error) {
+	return r.getItem(ctx, TypeKey(itemType), RoNone)
+}
+
+func (r *resolution) GetItemWithOptionsContext(ctx context.Context, itemType reflect.Type, options ResolveOptions) (interface{}, error) {
+	return r.getItem(ctx, TypeKey(itemType), options)
+}
+
+func (r *resolution) GetKeyedItemWithOptionsContext(ctx context.Context, key ItemKey, options ResolveOptions) (interface{}, error) {
+	return r.getItem(ctx, key, options)
+}
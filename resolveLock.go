@@ -0,0 +1,179 @@
+package discovery
+
+import "sync"
+
+// flight is the in-flight resolution of an item by a discovery, which is
+// shared by every caller that requests the item while it is being resolved
+//
+//	Notes
+//		Flights only exist while the item is being resolved, so the number of
+//		flights is bounded by the number of concurrent resolutions rather than
+//		the number of item types ever resolved
+//
+//		holder is protected by resolveWaits.lock. item and err are written by
+//		the holder before done is closed
+type flight struct {
+	key    ItemKey
+	holder *resolution
+	done   chan struct{}
+
+	item interface{}
+	err  error
+}
+
+// resolveWaits is the wait-for graph of resolutions that are waiting for a
+// flight held by another resolution
+//
+//	Notes
+//		It is shared by every discovery, so that deadlocks that span base and
+//		super discoveries or several goroutines are detected
+type resolveWaits struct {
+	lock    sync.Mutex
+	waiting map[*resolution]*flight
+}
+
+var waits = &resolveWaits{waiting: map[*resolution]*flight{}}
+
+// joinFlight returns the flight for the item of r, and whether r holds it
+//
+//	Notes
+//		If the item is not being resolved, a flight is started with r as its
+//		holder. Otherwise r waits for the flight to land, and shares its
+//		result
+//
+//		ErrCircularResolveDependency is returned, rather than waiting, if the
+//		item is already being resolved by the chain of r, or if waiting would
+//		deadlock with another resolution chain
+//
+//		ctx.Err() is returned if the context of r is done while waiting
+func (d *ItemDiscovery) joinFlight(r *resolution) (f *flight, holder bool, err error) {
+	if path := r.cyclePath(); path != nil {
+		return nil, false, newCircularDependencyError(ErrorContext{Path: path, Layer: d.layer()}, r.key)
+	}
+
+	d.resolveLock.Lock()
+	f, ok := d.flights[r.key]
+	if !ok {
+		f = &flight{key: r.key, done: make(chan struct{})}
+		d.flights[r.key] = f
+
+		// the holder is recorded before the flight can be found by waiters
+		waits.acquired(r, f)
+	}
+	d.resolveLock.Unlock()
+
+	if !ok {
+		return f, true, nil
+	}
+
+	if path := waits.wait(r, f); path != nil {
+		return nil, false, newCircularDependencyError(ErrorContext{Path: path, Layer: d.layer()}, r.key)
+	}
+
+	select {
+	case <-f.done:
+		waits.cancel(r)
+		return f, false, nil
+	case <-r.ctx.Done():
+		waits.cancel(r)
+		return nil, false, r.ctx.Err()
+	}
+}
+
+// landFlight records the result of f, removes it from discovery and
+// releases the callers that are waiting for it
+func (d *ItemDiscovery) landFlight(f *flight, item interface{}, err error) {
+	f.item, f.err = item, err
+
+	waits.released(f)
+
+	d.resolveLock.Lock()
+	delete(d.flights, f.key)
+	d.resolveLock.Unlock()
+
+	close(f.done)
+}
+
+// wait registers r as waiting for f, unless waiting would deadlock, in which
+// case the circular path is returned
+func (w *resolveWaits) wait(r *resolution, f *flight) ResolvePath {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if path := w.deadlockPath(r, f, r.path(), map[*flight]bool{}); path != nil {
+		return path
+	}
+
+	w.waiting[r] = f
+	return nil
+}
+
+// deadlockPath follows the wait-for graph from f and returns the circular
+// path if it leads back to the chain of r
+//
+//	Notes
+//		f is held by a resolution, and if one of the resolutions started
+//		(directly or indirectly) by the holder is itself waiting, the holder
+//		cannot complete until that wait is over
+func (w *resolveWaits) deadlockPath(r *resolution, f *flight, path ResolvePath, visited map[*flight]bool) ResolvePath {
+	holder := f.holder
+	if (holder == nil) || visited[f] {
+		return nil
+	}
+	visited[f] = true
+
+	if r.descendsFrom(holder) {
+		return trimCycle(path)
+	}
+
+	for waiter, next := range w.waiting {
+		if !waiter.descendsFrom(holder) {
+			continue
+		}
+
+		waiterPath := append(append(ResolvePath{}, path...), waiter.pathFrom(holder)[1:]...)
+		if result := w.deadlockPath(r, next, waiterPath, visited); result != nil {
+			return result
+		}
+	}
+
+	return nil
+}
+
+// cancel removes r from the resolutions that are waiting
+func (w *resolveWaits) cancel(r *resolution) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	delete(w.waiting, r)
+}
+
+// acquired records r as the holder of f
+func (w *resolveWaits) acquired(r *resolution, f *flight) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	delete(w.waiting, r)
+	f.holder = r
+}
+
+// released records that f is no longer held
+func (w *resolveWaits) released(f *flight) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	f.holder = nil
+}
+
+// trimCycle trims the keys that precede the cycle at the end of path
+func trimCycle(path ResolvePath) ResolvePath {
+	last := path[len(path)-1]
+
+	for i := 0; i < len(path)-1; i++ {
+		if path[i] == last {
+			return path[i:]
+		}
+	}
+
+	return path
+}
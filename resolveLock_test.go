@@ -0,0 +1,562 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type cycleA interface{}
+type cycleB interface{}
+type cycleC interface{}
+
+var cycleAType = reflect.TypeOf((*cycleA)(nil)).Elem()
+var cycleBType = reflect.TypeOf((*cycleB)(nil)).Elem()
+var cycleCType = reflect.TypeOf((*cycleC)(nil)).Elem()
+
+// dependsOn returns a Creator that acquires every dependency first
+func dependsOn(deps ...reflect.Type) Resolver {
+	return func(d Discovery) (interface{}, error) {
+		for _, dep := range deps {
+			if _, err := d.GetItem(dep); err != nil {
+				return nil, err
+			}
+		}
+		return &testItemImpl{}, nil
+	}
+}
+
+func TestCircularDependency(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.AddMappingsVar(
+		ResolverMapping{Type: cycleAType, Creator: dependsOn(cycleBType)},
+		ResolverMapping{Type: cycleBType, Creator: dependsOn(cycleCType)},
+		ResolverMapping{Type: cycleCType, Creator: dependsOn(cycleAType)})
+
+	d := NewItemDiscovery(resolver)
+
+	var err error
+	assert.NotPanics(t, func() { _, err = d.GetItem(cycleAType) })
+	assert.Error(t, err)
+
+	path := ResolvePath{TypeKey(cycleAType), TypeKey(cycleBType), TypeKey(cycleCType), TypeKey(cycleAType)}
+	assert.Contains(t, err.Error(), path.String())
+
+	// the locks were released, so the failure is repeatable
+	_, err = d.GetItem(cycleBType)
+	assert.Error(t, err)
+	assert.Len(t, waits.waiting, 0)
+
+	// the chain continues through a super discovery
+	superD := NewItemDiscoveryWithBase(d, nil)
+	_, err = superD.GetItem(cycleCType)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "circular")
+}
+
+func TestConcurrentResolveIsNotCircular(t *testing.T) {
+	release := make(chan struct{})
+
+	resolver := NewBaseItemResolver()
+	resolver.AddMapping(ResolverMapping{
+		Type: cycleAType,
+		Creator: func(d Discovery) (interface{}, error) {
+			<-release
+			return &testItemImpl{}, nil
+		},
+	})
+
+	d := NewItemDiscovery(resolver)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = d.GetItem(cycleAType)
+		}(i)
+	}
+
+	close(release)
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+}
+
+// awaitWaiters waits until n resolutions are waiting for a flight
+func awaitWaiters(n int) {
+	for {
+		waits.lock.Lock()
+		waiting := len(waits.waiting)
+		waits.lock.Unlock()
+
+		if waiting == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrentResolveSharesResult(t *testing.T) {
+	release := make(chan struct{})
+	var created atomic.Int32
+	fail := true
+
+	resolver := NewBaseItemResolver()
+	resolver.AddMapping(ResolverMapping{
+		Type: cycleAType,
+		Creator: func(d Discovery) (interface{}, error) {
+			created.Add(1)
+			<-release
+			if fail {
+				return nil, errors.New("failed")
+			}
+			return &testItemImpl{}, nil
+		},
+	})
+
+	d := NewItemDiscovery(resolver)
+
+	resolveAll := func() ([]interface{}, []error) {
+		var wg sync.WaitGroup
+		items := make([]interface{}, 4)
+		errs := make([]error, 4)
+
+		for i := range items {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				items[i], errs[i] = d.GetItem(cycleAType)
+			}(i)
+		}
+
+		// wait for every caller to join the flight
+		awaitWaiters(len(items) - 1)
+
+		release <- struct{}{}
+		wg.Wait()
+
+		return items, errs
+	}
+
+	// failures are shared with the callers that joined the flight
+	_, errs := resolveAll()
+	assert.Equal(t, int32(1), created.Load())
+	for _, err := range errs {
+		assert.ErrorContains(t, err, "failed")
+	}
+
+	// once the flight lands, the next caller starts a new one
+	fail = false
+	items, errs := resolveAll()
+	assert.Equal(t, int32(2), created.Load())
+	for i, err := range errs {
+		assert.NoError(t, err)
+		assert.Same(t, items[0], items[i])
+	}
+
+	assert.Empty(t, d.flights)
+	assert.Len(t, waits.waiting, 0)
+}
+
+func TestFlightsAreBounded(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	d := NewItemDiscovery(resolver)
+
+	resolver.AddMapping(ResolverMapping{
+		Type: cycleAType,
+		Creator: func(Discovery) (interface{}, error) {
+			d.resolveLock.Lock()
+			defer d.resolveLock.Unlock()
+
+			// instances are not shared, so they are created without a flight
+			_, ok := d.flights[TypeKey(cycleAType)]
+			return ok, nil
+		},
+	})
+
+	for i := 0; i < 100; i++ {
+		resolver.AddMapping(ResolverMapping{
+			Type: cycleBType,
+			Name: fmt.Sprint(i),
+			Creator: func(Discovery) (interface{}, error) {
+				return &testItemImpl{}, nil
+			},
+		})
+
+		_, err := d.GetKeyedItem(NamedKey(cycleBType, fmt.Sprint(i)))
+		assert.NoError(t, err)
+	}
+
+	inFlight, err := d.GetItemWithOptions(cycleAType, RoInstanceItem)
+	assert.NoError(t, err)
+	assert.Equal(t, false, inFlight)
+
+	// cached items keep their flight only while they are being resolved
+	inFlight, err = d.GetItem(cycleAType)
+	assert.NoError(t, err)
+	assert.Equal(t, true, inFlight)
+
+	assert.Empty(t, d.flights)
+}
+
+func TestConcurrentResolveAcrossLayers(t *testing.T) {
+	newResolver := func(lifetime Lifetime, created *atomic.Int32, started, release chan struct{}) *BaseItemResolver {
+		resolver := NewBaseItemResolver()
+		resolver.AddMapping(ResolverMapping{
+			Type:     cycleAType,
+			Lifetime: lifetime,
+			Creator: func(d Discovery) (interface{}, error) {
+				created.Add(1)
+				close(started)
+				<-release
+				return &testItemImpl{}, nil
+			},
+		})
+		return resolver
+	}
+
+	resolveAll := func(layers ...Discovery) []interface{} {
+		var wg sync.WaitGroup
+		items := make([]interface{}, 2*len(layers))
+
+		for i := range items {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				items[i] = layers[i%len(layers)].GetRequiredItem(cycleAType)
+			}(i)
+		}
+
+		wg.Wait()
+		return items
+	}
+
+	for _, shared := range []bool{false, true} {
+		var created atomic.Int32
+		started := make(chan struct{})
+		release := make(chan struct{})
+
+		// the singletons of a shared resolver are owned by the base, so
+		// every layer is expected to join the flight of the base
+		lifetime := LtDefault
+		if shared {
+			lifetime = LtSingleton
+		}
+
+		resolver := newResolver(lifetime, &created, started, release)
+		base := NewItemDiscovery(resolver)
+
+		var superResolver ItemResolver
+		if shared {
+			superResolver = resolver
+		}
+		superD := NewItemDiscoveryWithBase(base, superResolver)
+		superSuperD := NewItemDiscoveryWithBase(superD, superResolver)
+
+		go func() {
+			<-started
+			awaitWaiters(5)
+			close(release)
+		}()
+
+		items := resolveAll(base, superD, superSuperD)
+
+		assert.Equal(t, int32(1), created.Load(), "shared: %v", shared)
+		for _, item := range items {
+			assert.Same(t, items[0], item, "shared: %v", shared)
+		}
+
+		// the item is cached by the base only
+		assert.True(t, base.HasItem(cycleAType))
+		assert.False(t, superD.HasItem(cycleAType))
+		assert.False(t, superSuperD.HasItem(cycleAType))
+	}
+}
+
+func TestSharedResolverOwnership(t *testing.T) {
+	newItem := func(Discovery) (interface{}, error) { return &MockService{}, nil }
+
+	resolver := NewBaseItemResolver()
+	resolver.AddMapping(ResolverMapping{Type: cycleAType, Lifetime: LtSingleton, Creator: newItem})
+	resolver.AddMapping(ResolverMapping{Type: cycleBType, Lifetime: LtScoped, Creator: newItem})
+	resolver.AddMapping(ResolverMapping{Type: cycleCType, Dependencies: []ItemKey{TypeKey(cycleAType)}, Creator: newItem})
+
+	middle := NewBaseItemResolver()
+	middle.AddMapping(ResolverMapping{Type: cycleAType, Creator: newItem})
+
+	base := NewItemDiscovery(resolver)
+
+	// a discovery in between with its own mapping takes precedence, so the
+	// super discovery owns the mapping of its (shared) resolver
+	superD := NewItemDiscoveryWithBase(NewItemDiscoveryWithBase(base, middle), resolver)
+	assert.NotSame(t, base.GetRequiredItem(cycleAType), superD.GetRequiredItem(cycleAType))
+	assert.True(t, superD.HasItem(cycleAType))
+
+	// without one, the base owns singletons
+	superD = NewItemDiscoveryWithBase(NewItemDiscoveryWithBase(base, nil), resolver)
+	assert.Same(t, base.GetRequiredItem(cycleAType), superD.GetRequiredItem(cycleAType))
+	assert.False(t, superD.HasItem(cycleAType))
+
+	// and the mappings whose dependencies it resolves
+	assert.Same(t, base.GetRequiredItem(cycleCType), superD.GetRequiredItem(cycleCType))
+	assert.False(t, superD.HasItem(cycleCType))
+
+	// instances of mappings owned by the base are created for the caller
+	instance, err := superD.GetItemWithOptions(cycleCType, RoInstanceItem)
+	assert.NoError(t, err)
+	assert.NotNil(t, instance)
+	assert.NotSame(t, base.GetRequiredItem(cycleCType), instance)
+	assert.False(t, superD.HasItem(cycleCType))
+
+	// scoped items are resolved by every discovery
+	assert.NotSame(t, base.GetRequiredItem(cycleBType), superD.GetRequiredItem(cycleBType))
+	assert.True(t, superD.HasItem(cycleBType))
+
+	// a dependency added to the super discovery moves ownership to it
+	superD = NewItemDiscoveryWithBase(base, resolver)
+	assert.NoError(t, superD.AddItem(cycleAType, &MockService{}))
+	assert.NotSame(t, base.GetRequiredItem(cycleCType), superD.GetRequiredItem(cycleCType))
+	assert.True(t, superD.HasItem(cycleCType))
+}
+
+type rvReq struct{ id int }
+
+type rvHandler struct{ req *rvReq }
+
+func TestSharedResolverPerRequest(t *testing.T) {
+	reqType := TypeOf[*rvReq]()
+	handlerType := TypeOf[*rvHandler]()
+
+	// the creator depends on an item that only the super discoveries have,
+	// without declaring it
+	resolver := NewBaseItemResolver()
+	resolver.AddMapping(ResolverMapping{
+		Type: handlerType,
+		Creator: func(d Discovery) (interface{}, error) {
+			req, err := d.GetItem(reqType)
+			if err != nil {
+				return nil, err
+			}
+			return &rvHandler{req: req.(*rvReq)}, nil
+		},
+	})
+
+	base := NewItemDiscovery(resolver)
+
+	for id := 1; id <= 2; id++ {
+		request := NewItemDiscoveryWithBase(base, base.GetResolver())
+		assert.NoError(t, request.AddItem(reqType, &rvReq{id: id}))
+
+		handler, err := request.GetItem(handlerType)
+		if assert.NoError(t, err) {
+			assert.Equal(t, id, handler.(*rvHandler).req.id)
+		}
+		assert.True(t, request.HasItem(handlerType))
+	}
+
+	assert.False(t, base.HasItem(handlerType))
+}
+
+func TestCrossGoroutineDeadlock(t *testing.T) {
+	aStarted := make(chan struct{})
+	bStarted := make(chan struct{})
+
+	var aOnce, bOnce sync.Once
+
+	resolver := NewBaseItemResolver()
+	resolver.AddMappingsVar(
+		ResolverMapping{
+			Type: cycleAType,
+			Creator: func(d Discovery) (interface{}, error) {
+				aOnce.Do(func() { close(aStarted) })
+				<-bStarted
+				return dependsOn(cycleBType)(d)
+			},
+		},
+		ResolverMapping{
+			Type: cycleBType,
+			Creator: func(d Discovery) (interface{}, error) {
+				bOnce.Do(func() { close(bStarted) })
+				<-aStarted
+				return dependsOn(cycleAType)(d)
+			},
+		})
+
+	d := NewItemDiscovery(resolver)
+
+	var wg sync.WaitGroup
+	var errA, errB error
+
+	wg.Add(2)
+	go func() { defer wg.Done(); _, errA = d.GetItem(cycleAType) }()
+	go func() { defer wg.Done(); _, errB = d.GetItem(cycleBType) }()
+	wg.Wait()
+
+	// waiting would deadlock, so the chain that waits last is reported. The
+	// other chain then shares the error of the flight it was waiting for
+	assert.Error(t, errA)
+	assert.Contains(t, errA.Error(), "circular")
+	assert.Error(t, errB)
+	assert.Contains(t, errB.Error(), "circular")
+	assert.Len(t, waits.waiting, 0)
+}
+
+type ctxKey struct{}
+
+func TestResolveContext(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.AddMappingsVar(
+		ResolverMapping{Type: cycleAType, Creator: dependsOn(cycleBType)},
+		ResolverMapping{
+			Type: cycleBType,
+			ContextCreator: func(ctx context.Context, d Discovery) (interface{}, error) {
+				// the context flows to nested resolutions
+				return ctx.Value(ctxKey{}), nil
+			},
+		})
+
+	d := NewItemDiscovery(resolver)
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	_, err := d.GetItemContext(ctx, cycleAType)
+	assert.NoError(t, err)
+	assert.Equal(t, "value", d.GetRequiredItem(cycleBType))
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = d.GetItemWithOptionsContext(cancelled, cycleAType, RoInstanceItem)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestResolveContextCancelsWaiters(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	resolver := NewBaseItemResolver()
+	resolver.AddMapping(ResolverMapping{
+		Type: cycleAType,
+		Creator: func(d Discovery) (interface{}, error) {
+			close(started)
+			<-release
+			return &testItemImpl{}, nil
+		},
+	})
+
+	d := NewItemDiscovery(resolver)
+
+	done := make(chan error)
+	go func() {
+		_, err := d.GetItem(cycleAType)
+		done <- err
+	}()
+
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// the waiter is released while the creator is still running
+	_, err := d.GetItemContext(ctx, cycleAType)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(release)
+	assert.NoError(t, <-done)
+	assert.Len(t, waits.waiting, 0)
+}
+
+func TestResolveContextOfHolder(t *testing.T) {
+	started := make(chan struct{})
+	var calls atomic.Int32
+
+	resolver := NewBaseItemResolver()
+	resolver.AddMapping(ResolverMapping{
+		Type: cycleAType,
+		ContextCreator: func(ctx context.Context, d Discovery) (interface{}, error) {
+			if calls.Add(1) == 1 {
+				close(started)
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			return &testItemImpl{}, nil
+		},
+	})
+
+	d := NewItemDiscovery(resolver)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		_, err := d.GetItemContext(ctx, cycleAType)
+		done <- err
+	}()
+
+	<-started
+
+	waited := make(chan error)
+	go func() {
+		_, err := d.GetItem(cycleAType)
+		waited <- err
+	}()
+
+	assert.Eventually(t, func() bool {
+		waits.lock.Lock()
+		defer waits.lock.Unlock()
+		return len(waits.waiting) == 1
+	}, time.Second, time.Millisecond)
+
+	// the holder gives up, but the waiter resolves the item itself
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.NoError(t, <-waited)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.True(t, d.HasItem(cycleAType))
+}
+
+func TestCreatorPanics(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.AddMappingsVar(
+		ResolverMapping{Type: cycleAType, Creator: dependsOn(cycleBType)},
+		ResolverMapping{Type: cycleBType, Creator: func(d Discovery) (interface{}, error) {
+			panic("boom")
+		}})
+
+	d := NewItemDiscovery(resolver)
+
+	for i := 0; i < 2; i++ {
+		var err error
+		assert.NotPanics(t, func() { _, err = d.GetItem(cycleAType) })
+		assert.Error(t, err)
+
+		path := ResolvePath{TypeKey(cycleAType), TypeKey(cycleBType)}
+		assert.Contains(t, err.Error(), "creator panicked: boom")
+		assert.Contains(t, err.Error(), path.String())
+	}
+
+	// the flights landed
+	assert.Empty(t, d.flights)
+
+	// panics in AO creators are recovered as well
+	resolver.AddMapping(ResolverMapping{Type: cycleCType, Creator: dependsOn()})
+	resolver.AddAOMapping(AOResolverMapping{Type: cycleCType, Creator: func(d Discovery, item interface{}) (interface{}, error) {
+		panic(errors.New("ao boom"))
+	}})
+
+	_, err := d.GetItem(cycleCType)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "ao boom")
+}
@@ -1,25 +1,81 @@
 package discovery
 
-import "reflect"
+import (
+	"context"
+	"reflect"
+)
 
 // Resolver is the signature for a function that resolves an item
 type Resolver func(discovery Discovery) (interface{}, error)
 
+// ContextResolver is the signature for a function that resolves an item
+// with the context of the resolution
+type ContextResolver func(ctx context.Context, discovery Discovery) (interface{}, error)
+
 // ResolverMapping binds an item type with a function tha can instance it
+//
+//	Notes
+//		Name is optional and allows several mappings for the same Type to be
+//		registered under different names (e.g. "primary" and "replica")
+//
+//		Lifetime is optional and is enforced by discovery regardless of the
+//		ResolveOptions specified by callers (see Lifetime)
+//
+//		Either Creator or ContextCreator is required. ContextCreator is used
+//		if both are specified
+//
+//		Dependencies is optional and declares the items that the creator
+//		acquires from discovery (see NewConstructorMapping)
 type ResolverMapping struct {
-	Type    reflect.Type
-	Creator Resolver
+	Type           reflect.Type
+	Name           string
+	Creator        Resolver
+	ContextCreator ContextResolver
+	Lifetime       Lifetime
+	Dependencies   []ItemKey
+}
+
+// Key returns the ItemKey that the mapping resolves
+func (m ResolverMapping) Key() ItemKey {
+	return ItemKey{Type: m.Type, Name: m.Name}
+}
+
+// create creates an item via the creator of the mapping
+func (m ResolverMapping) create(d Discovery) (interface{}, error) {
+	if m.ContextCreator != nil {
+		return m.ContextCreator(ResolveContext(d), d)
+	}
+
+	return m.Creator(d)
 }
 
+// MappingOptions represents flag values used when mappings are removed or
+// replaced
+type MappingOptions int
+
+const (
+	// MoNone represents no mapping options: items already created by the
+	// mapping remain in discovery
+	MoNone MappingOptions = 0
+	// MoEvict is used to indicate that items created by the mapping, and the
+	// cached items that depend on them, should be evicted from every
+	// ItemDiscovery that uses the resolver
+	MoEvict MappingOptions = 1 << 0
+)
+
 // ItemResolver is used during discovery to attempt to resolve an item that
 //
 //	has not been previously resolved, or when the InstanceItem option is specified
 type ItemResolver interface {
 	ResolveItem(d Discovery, itemType reflect.Type) (interface{}, error)
+	ResolveKeyedItem(d Discovery, key ItemKey) (interface{}, error)
 	ResolveMapping(d Discovery, mapping ResolverMapping) (interface{}, error)
+	GetKeyedMapping(key ItemKey) (ResolverMapping, bool)
 	AddMapping(mapping ResolverMapping)
 	AddMappingsVar(mappings ...ResolverMapping)
 	AddMappings(mapping []ResolverMapping)
+	RemoveMapping(key ItemKey, options MappingOptions) bool
+	ReplaceMapping(mapping ResolverMapping, options MappingOptions) bool
 }
 
 // ItemResolverType is the reflected type of ItemResolver
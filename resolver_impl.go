@@ -1,51 +1,165 @@
 package discovery
 
 import (
+	stderrors "errors"
+	"fmt"
 	"reflect"
 	"sync"
+	"sync/atomic"
 
 	"github.com/gotomgo/coreutils/errors"
 )
 
 // BaseItemResolver provides item creation mappings
+//
+//	Notes
+//		Mappings are read without locking, lock serializes changes to them
 type BaseItemResolver struct {
 	lock       sync.Mutex
-	mappings   map[reflect.Type]ResolverMapping
-	aoMappings map[reflect.Type][]AOResolverMapping
+	mappings   syncMap[ItemKey, ResolverMapping]
+	aoMappings syncMap[reflect.Type, []AOResolverMapping]
+	sources    map[ItemKey]string
+	observers  weakSet[ItemDiscovery]
+	strict     atomic.Bool
+	conflicts  atomic.Int32
+	frozen     atomic.Bool
 }
 
+// observableResolver is implemented by resolvers that notify the
+// discoveries that cache their items when mappings are removed with MoEvict
+type observableResolver interface {
+	observe(d *ItemDiscovery)
+	unobserve(d *ItemDiscovery)
+}
+
+var _ observableResolver = &BaseItemResolver{}
+
 // ensure we are an implementation of AOItemResolver
 var _ AOItemResolver = &BaseItemResolver{}
 
 // NewBaseItemResolver creates an instance of BaseItemResolver
 func NewBaseItemResolver() *BaseItemResolver {
 	return &BaseItemResolver{
-		mappings:   map[reflect.Type]ResolverMapping{},
-		aoMappings: map[reflect.Type][]AOResolverMapping{},
+		sources: map[ItemKey]string{},
 	}
 }
 
+// SetStrictTypes sets how items created by mappings are type checked
+//
+//	Notes
+//		By default, items must be convertible to the type of their mapping.
+//		When strict, items must be assignable to (or implement) the type
+func (r *BaseItemResolver) SetStrictTypes(strict bool) {
+	r.strict.Store(strict)
+}
+
+// SetConflictPolicy sets what happens when a mapping is added for a key that
+// already has one (CpReplace by default)
+func (r *BaseItemResolver) SetConflictPolicy(policy ConflictPolicy) {
+	r.conflicts.Store(int32(policy))
+}
+
 // addMapping adds a ResolverMapping to the BaseItemResolver
-func (r *BaseItemResolver) addMapping(mapping ResolverMapping) {
-	r.mappings[mapping.Type] = mapping
+func (r *BaseItemResolver) addMapping(mapping ResolverMapping, source string) {
+	r.mappings.set(mapping.Key(), mapping)
+	r.sources[mapping.Key()] = source
+}
+
+// addMappings adds mappings registered at source, according to the conflict
+// policy, and returns the keys of the mappings that were stored
+//
+//	Notes
+//		Mappings are added together: if any mapping is rejected (CpError),
+//		none are added and every conflict is returned
+func (r *BaseItemResolver) addMappings(mappings []ResolverMapping, source string) ([]ItemKey, error) {
+	if r.frozen.Load() && (len(mappings) > 0) {
+		return nil, newFrozenError("add mapping", mappings[0].Key())
+	}
+
+	policy := ConflictPolicy(r.conflicts.Load())
+
+	var add []ResolverMapping
+	var errs []error
+
+	pending := map[ItemKey]bool{}
+	for _, mapping := range mappings {
+		key := mapping.Key()
+
+		if _, exists := r.mappings.get(key); exists || pending[key] {
+			existing := r.sources[key]
+			if pending[key] {
+				existing = source
+			}
+
+			store, err := policy.apply("mapping", key, source, existing)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if !store {
+				continue
+			}
+		}
+
+		pending[key] = true
+		add = append(add, mapping)
+	}
+
+	if len(errs) > 0 {
+		return nil, stderrors.Join(errs...)
+	}
+
+	stored := make([]ItemKey, 0, len(add))
+	for _, mapping := range add {
+		r.mappings.set(mapping.Key(), mapping)
+		r.sources[mapping.Key()] = source
+		stored = append(stored, mapping.Key())
+	}
+
+	return stored, nil
 }
 
 // AddMapping adds a ResolverMapping to the BaseItemResolver
+//
+//	Notes
+//		AddMapping panics if the mapping is rejected by CpError, or if the
+//		resolver is frozen (see TryAddMapping)
 func (r *BaseItemResolver) AddMapping(mapping ResolverMapping) {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-
-	r.addMapping(mapping)
+	r.AddMappings([]ResolverMapping{mapping})
 }
 
 // AddMappings adds an [] of ResolverMapping's to the BaseItemResolver
+//
+//	Notes
+//		AddMappings panics if a mapping is rejected by CpError, or if the
+//		resolver is frozen (see TryAddMappings)
 func (r *BaseItemResolver) AddMappings(mappings []ResolverMapping) {
+	if _, err := r.tryAddMappings(mappings, callerSource()); err != nil {
+		panic(err)
+	}
+}
+
+// TryAddMapping adds a ResolverMapping to the BaseItemResolver, and returns
+// a *DuplicateError if the mapping is rejected by CpError, or a
+// *FrozenError if the resolver is frozen
+func (r *BaseItemResolver) TryAddMapping(mapping ResolverMapping) error {
+	_, err := r.tryAddMappings([]ResolverMapping{mapping}, callerSource())
+	return err
+}
+
+// TryAddMappings adds an [] of ResolverMapping's to the BaseItemResolver,
+// and returns the conflicts if any mapping is rejected by CpError (or a
+// *FrozenError if the resolver is frozen), in which case no mappings are
+// added
+func (r *BaseItemResolver) TryAddMappings(mappings []ResolverMapping) error {
+	_, err := r.tryAddMappings(mappings, callerSource())
+	return err
+}
+
+func (r *BaseItemResolver) tryAddMappings(mappings []ResolverMapping, source string) ([]ItemKey, error) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
-	for _, mapping := range mappings {
-		r.addMapping(mapping)
-	}
+	return r.addMappings(mappings, source)
 }
 
 // AddMappingsVar adds a variadic list of ResolverMapping's to the BaseItemResolver
@@ -53,94 +167,317 @@ func (r *BaseItemResolver) AddMappingsVar(mappings ...ResolverMapping) {
 	r.AddMappings(mappings)
 }
 
-// GetMapping returns a ResolverMapping for itemType, if available
-func (r *BaseItemResolver) GetMapping(itemType reflect.Type) (ResolverMapping, bool) {
+// RemoveMapping removes the ResolverMapping for key, and returns true if there
+// was one
+//
+//	Notes
+//		With MoEvict, the items created by the mapping are removed from every
+//		ItemDiscovery that caches them, and are stopped or closed, since no
+//		discovery is responsible for them once evicted (see EvictionFailed).
+//		The cached items that depend on them (including those of super
+//		discoveries) are evicted first, so no cached item refers to them
+//
+//		RemoveMapping panics if the resolver is frozen (see TryRemoveMapping)
+func (r *BaseItemResolver) RemoveMapping(key ItemKey, options MappingOptions) bool {
+	removed, err := r.TryRemoveMapping(key, options)
+	if err != nil {
+		panic(err)
+	}
+
+	return removed
+}
+
+// TryRemoveMapping removes the ResolverMapping for key (see RemoveMapping),
+// and returns a *FrozenError if the resolver is frozen
+func (r *BaseItemResolver) TryRemoveMapping(key ItemKey, options MappingOptions) (bool, error) {
+	r.lock.Lock()
+	if r.frozen.Load() {
+		r.lock.Unlock()
+		return false, newFrozenError("remove mapping", key)
+	}
+	_, ok := r.mappings.get(key)
+	r.mappings.delete(key)
+	delete(r.sources, key)
+	r.lock.Unlock()
+
+	if ok {
+		r.evict(options, func(k ItemKey) bool { return k == key })
+	}
+
+	return ok, nil
+}
+
+// ReplaceMapping adds mapping to the BaseItemResolver, and returns true if
+// it replaced an existing mapping
+//
+//	Notes
+//		The conflict policy does not apply, replacing is explicit
+//
+//		With MoEvict, the items created by the replaced mapping are removed
+//		from every ItemDiscovery that caches them, along with the cached items
+//		that depend on them, and are stopped or closed, so that they are
+//		resolved again via the new mapping
+//
+//		ReplaceMapping panics if the resolver is frozen (see
+//		TryReplaceMapping)
+func (r *BaseItemResolver) ReplaceMapping(mapping ResolverMapping, options MappingOptions) bool {
+	replaced, err := r.TryReplaceMapping(mapping, options)
+	if err != nil {
+		panic(err)
+	}
+
+	return replaced
+}
+
+// TryReplaceMapping adds mapping to the BaseItemResolver (see
+// ReplaceMapping), and returns a *FrozenError if the resolver is frozen
+func (r *BaseItemResolver) TryReplaceMapping(mapping ResolverMapping, options MappingOptions) (bool, error) {
+	key := mapping.Key()
+	source := callerSource()
+
+	r.lock.Lock()
+	if r.frozen.Load() {
+		r.lock.Unlock()
+		return false, newFrozenError("replace mapping", key)
+	}
+	_, ok := r.mappings.get(key)
+	r.addMapping(mapping, source)
+	r.lock.Unlock()
+
+	if ok {
+		r.evict(options, func(k ItemKey) bool { return k == key })
+	}
+
+	return ok, nil
+}
+
+// evict notifies observers of removed mappings when options include MoEvict
+func (r *BaseItemResolver) evict(options MappingOptions, match func(key ItemKey) bool) {
+	if (options & MoEvict) == 0 {
+		return
+	}
+
+	r.lock.Lock()
+	observers := r.observers.live()
+	r.lock.Unlock()
+
+	for _, d := range observers {
+		d.mappingsRemoved(match)
+	}
+}
+
+// observe registers d for notification of removed mappings
+//
+//	Notes
+//		Discoveries are observed weakly, so that discoveries that are dropped
+//		without being shut down (e.g. per request super discoveries) can be
+//		collected. Their registrations are pruned as observers are added
+func (r *BaseItemResolver) observe(d *ItemDiscovery) {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
-	result, ok := r.mappings[itemType]
-	return result, ok
+	r.observers.add(d)
+}
+
+// unobserve removes the registration of d
+func (r *BaseItemResolver) unobserve(d *ItemDiscovery) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.observers.remove(d)
+}
+
+// GetMapping returns a ResolverMapping for itemType, if available
+func (r *BaseItemResolver) GetMapping(itemType reflect.Type) (ResolverMapping, bool) {
+	return r.GetKeyedMapping(TypeKey(itemType))
+}
+
+// GetKeyedMapping returns a ResolverMapping for key, if available
+func (r *BaseItemResolver) GetKeyedMapping(key ItemKey) (ResolverMapping, bool) {
+	return r.mappings.get(key)
+}
+
+// Mappings returns every ResolverMapping of the BaseItemResolver
+func (r *BaseItemResolver) Mappings() []ResolverMapping {
+	return r.mappings.values()
+}
+
+// AOMappings returns every AOResolverMapping of the BaseItemResolver
+func (r *BaseItemResolver) AOMappings() []AOResolverMapping {
+	var result []AOResolverMapping
+	for _, mappings := range r.aoMappings.values() {
+		result = append(result, mappings...)
+	}
+
+	return result
 }
 
 // ResolveItem returns an instance of itemType via its creator
 func (r *BaseItemResolver) ResolveItem(d Discovery, itemType reflect.Type) (interface{}, error) {
-	creator, ok := r.GetMapping(itemType)
+	return r.ResolveKeyedItem(d, TypeKey(itemType))
+}
+
+// ResolveKeyedItem returns an instance of the item identified by key via its
+// creator
+func (r *BaseItemResolver) ResolveKeyedItem(d Discovery, key ItemKey) (interface{}, error) {
+	mapping, ok := r.GetKeyedMapping(key)
 	if !ok {
 		return nil, nil
 	}
 
-	result, err := creator.Creator(d)
-	if errors.IsError(err) {
-		err = ErrItemNotResolved.Instance(itemType.Name(), err).WithInner(err)
-		return nil, err
-	}
-
-	return r.WrapAO(d, itemType, result)
+	return r.ResolveMapping(d, mapping)
 }
 
+// ResolveMapping returns an instance of mapping.Type via mapping.Creator
+//
+//	Notes
+//		ErrItemNotItemType is returned if the creator returns an item that is
+//		not of mapping.Type (see SetStrictTypes)
 func (r *BaseItemResolver) ResolveMapping(d Discovery, mapping ResolverMapping) (interface{}, error) {
-	result, err := mapping.Creator(d)
+	result, err := mapping.create(d)
 	if errors.IsError(err) {
-		err = ErrItemNotResolved.Instance(mapping.Type.Name(), err).WithInner(err)
+		err = newResolveError(errorContext(d, mapping.Key()), mapping.Key(), err, "")
 		return nil, err
 	}
 
+	if (result != nil) && !isItemType(mapping.Type, result, r.strict.Load()) {
+		return nil, newItemTypeError(errorContext(d, mapping.Key()), mapping.Type, result,
+			fmt.Sprintf("mapping %s", mapping.Key()))
+	}
+
 	return r.WrapAO(d, mapping.Type, result)
 }
 
 // GetAOMappings returns an []AOMapping for itemType, if available
 func (r *BaseItemResolver) GetAOMappings(itemType reflect.Type) (result []AOResolverMapping, ok bool) {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-
-	return r.getAOMappings(itemType)
-}
-
-// GetAOMappings returns an []AOMapping for itemType, if available
-func (r *BaseItemResolver) getAOMappings(itemType reflect.Type) (result []AOResolverMapping, ok bool) {
-	result, ok = r.aoMappings[itemType]
+	if result, ok = r.aoMappings.get(itemType); ok {
+		result = append([]AOResolverMapping(nil), result...)
+	}
 	return
 }
 
-// addMapping adds a ResolverMapping to the BaseItemResolver
-func (r *BaseItemResolver) addAOMapping(mapping AOResolverMapping) {
-	var mappings []AOResolverMapping
-	mappings = r.aoMappings[mapping.Type]
-	r.aoMappings[mapping.Type] = append(mappings, mapping)
+// addAOMappings adds AOMappings to the BaseItemResolver
+//
+//	Notes
+//		The []AOMapping of a type is never modified once stored, since it is
+//		read without locking
+func (r *BaseItemResolver) addAOMappings(mappings ...AOResolverMapping) {
+	for _, mapping := range mappings {
+		current, _ := r.aoMappings.get(mapping.Type)
+		r.aoMappings.set(mapping.Type, append(current[:len(current):len(current)], mapping))
+	}
 }
 
 // AddAOMapping adds an AOMapping to the AOItemResolver
+//
+//	Notes
+//		AddAOMapping panics if the resolver is frozen (see TryAddAOMapping)
 func (r *BaseItemResolver) AddAOMapping(mapping AOResolverMapping) {
-	r.lock.Lock()
-	defer r.lock.Unlock()
-
-	r.addAOMapping(mapping)
+	r.AddAOMappings([]AOResolverMapping{mapping})
 }
 
 // AddAOMappings adds a collection of AOMapping to the AOItemResolver
+//
+//	Notes
+//		AddAOMappings panics if the resolver is frozen (see TryAddAOMappings)
 func (r *BaseItemResolver) AddAOMappings(mappings []AOResolverMapping) {
+	if err := r.TryAddAOMappings(mappings); err != nil {
+		panic(err)
+	}
+}
+
+// TryAddAOMapping adds an AOMapping to the AOItemResolver, and returns a
+// *FrozenError if the resolver is frozen
+func (r *BaseItemResolver) TryAddAOMapping(mapping AOResolverMapping) error {
+	return r.TryAddAOMappings([]AOResolverMapping{mapping})
+}
+
+// TryAddAOMappings adds a collection of AOMapping to the AOItemResolver, and
+// returns a *FrozenError if the resolver is frozen, in which case no
+// mappings are added
+func (r *BaseItemResolver) TryAddAOMappings(mappings []AOResolverMapping) error {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
-	for _, mapping := range mappings {
-		r.addAOMapping(mapping)
+	if r.frozen.Load() && (len(mappings) > 0) {
+		return newFrozenError("add ao mapping", TypeKey(mappings[0].Type))
 	}
+
+	r.addAOMappings(mappings...)
+
+	return nil
 }
 
-// WrapAO wraps a core item with 0 or more AO items
-func (r *BaseItemResolver) WrapAO(d Discovery, itemType reflect.Type, item interface{}) (result interface{}, err error) {
+// RemoveAOMapping removes every AOMapping for itemType, and returns true if
+// there were any
+//
+//	Notes
+//		AO creators cannot be compared, so the mappings of itemType are removed
+//		together. Use AddAOMapping to add back the ones that should remain
+//
+//		With MoEvict, every item of itemType (named or not) is removed from
+//		every ItemDiscovery that caches it, along with the cached items that
+//		depend on it, and is stopped or closed, so that it is resolved again
+//		without the removed wrappers
+//
+//		RemoveAOMapping panics if the resolver is frozen (see
+//		TryRemoveAOMapping)
+func (r *BaseItemResolver) RemoveAOMapping(itemType reflect.Type, options MappingOptions) bool {
+	removed, err := r.TryRemoveAOMapping(itemType, options)
+	if err != nil {
+		panic(err)
+	}
+
+	return removed
+}
+
+// TryRemoveAOMapping removes every AOMapping for itemType (see
+// RemoveAOMapping), and returns a *FrozenError if the resolver is frozen
+func (r *BaseItemResolver) TryRemoveAOMapping(itemType reflect.Type, options MappingOptions) (bool, error) {
 	r.lock.Lock()
-	defer r.lock.Unlock()
+	if r.frozen.Load() {
+		r.lock.Unlock()
+		return false, newFrozenError("remove ao mapping", TypeKey(itemType))
+	}
+	_, ok := r.aoMappings.get(itemType)
+	r.aoMappings.delete(itemType)
+	r.lock.Unlock()
+
+	if ok {
+		r.evict(options, func(k ItemKey) bool { return k.Type == itemType })
+	}
 
+	return ok, nil
+}
+
+// WrapAO wraps a core item with 0 or more AO items
+//
+//	Notes
+//		ErrItemNotItemType is returned if an AO creator returns a wrapper that
+//		is not of itemType (see SetStrictTypes)
+//
+//		The AO creators are called without holding the resolver lock, so they
+//		are free to acquire items from discovery
+func (r *BaseItemResolver) WrapAO(d Discovery, itemType reflect.Type, item interface{}) (result interface{}, err error) {
 	// we need to return the core item in the case there are no AO mapping
 	result = item
 
-	if mappings, ok := r.getAOMappings(itemType); ok {
+	if mappings, ok := r.aoMappings.get(itemType); ok {
+		strict := r.strict.Load()
+
 		// create item wrappers in reverse order of registration so that what
 		// is registered first is 1st wrapper, 2nd is 2nd, and so on
 		for i := len(mappings) - 1; i >= 0; i-- {
 			if result, err = mappings[i].Creator(d, result); errors.IsError(err) {
-				err = ErrItemNotResolved.Instancef("ao mapping %s failed resolve: %s", mappings[i].Type, err).WithInner(err)
+				err = newResolveError(errorContext(d, TypeKey(itemType)), TypeKey(itemType), err,
+					fmt.Sprintf("ao mapping %s", typeName(mappings[i].Type)))
+				result = nil
+				return
+			}
+
+			if (result != nil) && !isItemType(itemType, result, strict) {
+				err = newItemTypeError(errorContext(d, TypeKey(itemType)), itemType, result,
+					fmt.Sprintf("ao mapping %d for %s", i, typeName(mappings[i].Type)))
 				result = nil
 				return
 			}
@@ -0,0 +1,245 @@
+package discovery
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type versionedItem struct {
+	version int
+}
+
+var versionedType = TypeOf[*versionedItem]()
+
+func versionMapping(version int) ResolverMapping {
+	return ResolverMapping{
+		Type: versionedType,
+		Creator: func(d Discovery) (interface{}, error) {
+			return &versionedItem{version: version}, nil
+		}}
+}
+
+func TestRemoveMapping(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.AddMapping(versionMapping(1))
+
+	d := NewItemDiscovery(resolver)
+	_, err := Get[*versionedItem](d)
+	assert.NoError(t, err)
+
+	// without eviction, the resolved item remains
+	assert.True(t, resolver.RemoveMapping(TypeKey(versionedType), MoNone))
+	assert.False(t, resolver.RemoveMapping(TypeKey(versionedType), MoNone))
+	assert.True(t, d.HasItem(versionedType))
+
+	// with eviction, the resolved item is removed from every discovery
+	resolver.AddMapping(versionMapping(1))
+	d2 := NewItemDiscovery(resolver)
+	_, err = Get[*versionedItem](d2)
+	assert.NoError(t, err)
+
+	d.RemoveItem(versionedType)
+	_, err = Get[*versionedItem](d)
+	assert.NoError(t, err)
+
+	assert.True(t, resolver.RemoveMapping(TypeKey(versionedType), MoEvict))
+	assert.False(t, d.HasItem(versionedType))
+	assert.False(t, d2.HasItem(versionedType))
+
+	_, err = Get[*versionedItem](d)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Empty(t, d.ownedItems())
+}
+
+func TestRemoveMappingKeepsAddedItems(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.AddMapping(versionMapping(1))
+
+	d := NewItemDiscovery(resolver)
+	_, err := Get[*versionedItem](d)
+	assert.NoError(t, err)
+
+	added := &versionedItem{version: 2}
+	assert.NoError(t, Set(d, added))
+
+	resolver.RemoveMapping(TypeKey(versionedType), MoEvict)
+
+	item, err := Get[*versionedItem](d)
+	assert.NoError(t, err)
+	assert.Same(t, added, item)
+}
+
+func TestReplaceMapping(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	assert.False(t, resolver.ReplaceMapping(versionMapping(1), MoEvict))
+
+	d := NewItemDiscovery(resolver)
+	item, err := Get[*versionedItem](d)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, item.version)
+
+	assert.True(t, resolver.ReplaceMapping(versionMapping(2), MoNone))
+	item, err = Get[*versionedItem](d)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, item.version)
+
+	assert.True(t, resolver.ReplaceMapping(versionMapping(3), MoEvict))
+	item, err = Get[*versionedItem](d)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, item.version)
+}
+
+func TestRemoveAOMapping(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.AddMappingsVar(versionMapping(1), ResolverMapping{
+		Type: versionedType,
+		Name: "named",
+		Creator: func(d Discovery) (interface{}, error) {
+			return &versionedItem{version: 1}, nil
+		}})
+	resolver.AddAOMapping(AOResolverMapping{
+		Type: versionedType,
+		Creator: func(d Discovery, item interface{}) (interface{}, error) {
+			return &versionedItem{version: item.(*versionedItem).version + 10}, nil
+		}})
+
+	d := NewItemDiscovery(resolver)
+	item, err := Get[*versionedItem](d)
+	assert.NoError(t, err)
+	assert.Equal(t, 11, item.version)
+
+	named, err := d.GetKeyedItem(NamedKey(versionedType, "named"))
+	assert.NoError(t, err)
+	assert.Equal(t, 11, named.(*versionedItem).version)
+
+	assert.True(t, resolver.RemoveAOMapping(versionedType, MoEvict))
+	assert.False(t, resolver.RemoveAOMapping(versionedType, MoEvict))
+
+	item, err = Get[*versionedItem](d)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, item.version)
+
+	named, err = d.GetKeyedItem(NamedKey(versionedType, "named"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, named.(*versionedItem).version)
+}
+
+func TestEvictScopedItemsOfSuperDiscovery(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	mapping := versionMapping(1)
+	mapping.Lifetime = LtScoped
+	resolver.AddMapping(mapping)
+
+	base := NewItemDiscovery(resolver)
+	super := NewItemDiscoveryWithBase(base, nil)
+
+	_, err := Get[*versionedItem](super)
+	assert.NoError(t, err)
+	assert.True(t, super.HasItem(versionedType))
+
+	resolver.RemoveMapping(TypeKey(versionedType), MoEvict)
+	assert.False(t, super.HasItem(versionedType))
+
+	// shutdown stops the observation of the resolver
+	resolver.AddMapping(mapping)
+	_, err = Get[*versionedItem](super)
+	assert.NoError(t, err)
+	assert.NoError(t, super.Shutdown(context.Background()))
+	assert.Zero(t, resolver.observers.len())
+}
+
+func TestEvictReleasesItems(t *testing.T) {
+	log := &lifecycleLog{}
+	resolver := newServiceResolver(log, nil).(*BaseItemResolver)
+	resolver.AddMapping(ResolverMapping{
+		Type: cycleAType,
+		Creator: func(d Discovery) (interface{}, error) {
+			return &closerItem{name: "x", log: log}, nil
+		}})
+
+	d := NewItemDiscovery(resolver)
+	d.GetRequiredItem(lifecycleBType)
+	d.GetRequiredItem(cycleAType)
+	assert.NoError(t, d.Start(context.Background()))
+
+	// started items are stopped, and are not stopped again by Stop
+	resolver.RemoveMapping(TypeKey(lifecycleBType), MoEvict)
+	assert.Equal(t, []string{"start a", "start b", "stop b"}, log.get())
+	assert.Equal(t, 1, d.started.Len())
+
+	// other items are closed
+	resolver.RemoveMapping(TypeKey(cycleAType), MoEvict)
+	assert.Equal(t, "close x", log.get()[3])
+
+	assert.NoError(t, d.Shutdown(context.Background()))
+	assert.Equal(t, []string{"start a", "start b", "stop b", "close x", "stop a"}, log.get())
+}
+
+func TestEvictDependents(t *testing.T) {
+	log := &lifecycleLog{}
+
+	// user depends on dep, in the base and in a super discovery
+	newCloser := func(name string, deps ...reflect.Type) Resolver {
+		return func(d Discovery) (interface{}, error) {
+			for _, dep := range deps {
+				d.GetRequiredItem(dep)
+			}
+			return &closerItem{name: name, log: log}, nil
+		}
+	}
+
+	resolver := NewBaseItemResolver()
+	resolver.AddMappingsVar(
+		ResolverMapping{Type: cycleAType, Creator: newCloser("dep")},
+		ResolverMapping{Type: cycleBType, Creator: newCloser("user", cycleAType)})
+
+	superResolver := NewBaseItemResolver()
+	superResolver.AddMapping(ResolverMapping{Type: cycleCType, Creator: newCloser("super user", cycleBType)})
+
+	base := NewItemDiscovery(resolver)
+	super := NewItemDiscoveryWithBase(base, superResolver)
+	super.GetRequiredItem(cycleCType)
+
+	// dependents are evicted, and closed before the items they depend on
+	resolver.ReplaceMapping(ResolverMapping{Type: cycleAType, Creator: newCloser("new dep")}, MoEvict)
+	assert.Equal(t, []string{"close super user", "close user", "close dep"}, log.get())
+	assert.False(t, base.HasItem(cycleAType))
+	assert.False(t, base.HasItem(cycleBType))
+	assert.False(t, super.HasItem(cycleCType))
+
+	// and are resolved again with the new dependency
+	super.GetRequiredItem(cycleCType)
+	assert.NoError(t, super.Shutdown(context.Background()))
+	assert.NoError(t, base.Shutdown(context.Background()))
+	assert.Equal(t, []string{"close super user", "close user", "close dep", "close super user", "close user", "close new dep"}, log.get())
+}
+
+func TestObserversAreBounded(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	mapping := versionMapping(1)
+	mapping.Lifetime = LtScoped
+	resolver.AddMappingsVar(mapping, ResolverMapping{Type: cycleAType, Creator: dependsOn()})
+
+	base := NewItemDiscovery(resolver)
+
+	// items that are not cached are not observed
+	_, err := base.GetItemWithOptions(cycleAType, RoInstanceItem)
+	assert.NoError(t, err)
+	assert.Zero(t, resolver.observers.len())
+
+	// super discoveries that are dropped without shutdown are collected
+	for i := 0; i < 2000; i++ {
+		if (i % 100) == 0 {
+			runtime.GC()
+		}
+
+		_, err := Get[*versionedItem](NewItemDiscoveryWithBase(base, nil))
+		assert.NoError(t, err)
+	}
+
+	assert.Less(t, resolver.observers.len(), 500)
+}
@@ -0,0 +1,49 @@
+package discovery
+
+import "sync"
+
+// syncMap is a typed sync.Map, which is read without locking
+//
+//	Notes
+//		sync.Map is a concurrent hash-trie, so a write only locks the node of
+//		its key, and does not copy the map as a copy-on-write map would.
+//		Filling a map with n entries is O(n) rather than O(n²)
+//
+//		Writes that depend on a read (e.g. conflict checks) must be
+//		serialized by the owner of the map
+type syncMap[K comparable, V any] struct {
+	m sync.Map
+}
+
+// get returns the value of key
+func (m *syncMap[K, V]) get(key K) (V, bool) {
+	value, ok := m.m.Load(key)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+
+	return value.(V), true
+}
+
+// set sets the value of key
+func (m *syncMap[K, V]) set(key K, value V) {
+	m.m.Store(key, value)
+}
+
+// delete removes key
+func (m *syncMap[K, V]) delete(key K) {
+	m.m.Delete(key)
+}
+
+// values returns the values of the map, which reflect the writes that
+// completed before values was called
+func (m *syncMap[K, V]) values() []V {
+	var result []V
+	m.m.Range(func(_, value any) bool {
+		result = append(result, value.(V))
+		return true
+	})
+
+	return result
+}
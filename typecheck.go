@@ -0,0 +1,24 @@
+package discovery
+
+import "reflect"
+
+// isItemType returns true if item can be used as an item of itemType
+//
+//	Notes
+//		By default, item must be convertible to itemType (the check used by
+//		AddItem). When strict, item must be assignable to itemType, which for
+//		interface types means that item implements itemType. Strict checking
+//		guarantees that GetItem[T] succeeds for T of itemType, which otherwise
+//		returns an *ItemTypeError for items that are only convertible
+func isItemType(itemType reflect.Type, item interface{}, strict bool) bool {
+	actual := reflect.TypeOf(item)
+	if actual == nil {
+		return false
+	}
+
+	if strict {
+		return actual.AssignableTo(itemType)
+	}
+
+	return actual.ConvertibleTo(itemType)
+}
@@ -0,0 +1,264 @@
+package discovery
+
+import (
+	stderrors "errors"
+	"fmt"
+	"reflect"
+)
+
+// Sentinel errors for use with the standard library errors.Is
+//
+//	Notes
+//		The errors returned by discovery are the typed errors below. Their
+//		messages are those of the corresponding coreutils error templates
+//		(e.g. ErrItemNotFound), and they unwrap to the template instance, so
+//		existing coreutils based handling is unchanged
+var (
+	// ErrNotFound matches *NotFoundError
+	ErrNotFound = stderrors.New("discovery: item not found")
+	// ErrNotResolved matches *ResolveError
+	ErrNotResolved = stderrors.New("discovery: item not resolved")
+	// ErrCircularDependency matches *CircularDependencyError
+	ErrCircularDependency = stderrors.New("discovery: circular resolve dependency")
+	// ErrNotItemType matches *ItemTypeError
+	ErrNotItemType = stderrors.New("discovery: item is not of item type")
+	// ErrLifetime matches *LifetimeError
+	ErrLifetime = stderrors.New("discovery: lifetime conflict")
+	// ErrDuplicate matches *DuplicateError
+	ErrDuplicate = stderrors.New("discovery: duplicate registration")
+	// ErrFrozen matches *FrozenError
+	ErrFrozen = stderrors.New("discovery: frozen")
+)
+
+// ErrorContext is carried by every error returned by resolution
+//
+//	Notes
+//		Path is the resolution path that led to the error. It ends with the
+//		item the error is about, and starts with the item requested by the
+//		caller
+//
+//		Layer is the depth of the discovery where the error occurred in its
+//		chain of base discoveries: 0 for a discovery without a base, 1 for a
+//		super discovery of it, and so on
+type ErrorContext struct {
+	Path  ResolvePath
+	Layer int
+}
+
+// describe returns the context as a message suffix, which is empty for
+// errors about the item requested by the caller of a discovery without base
+func (c ErrorContext) describe() string {
+	if (len(c.Path) <= 1) && (c.Layer == 0) {
+		return ""
+	}
+
+	return fmt.Sprintf(" (resolving %s in layer %d)", c.Path, c.Layer)
+}
+
+// errorContext returns the ErrorContext of an error about key, that occurred
+// in d
+func errorContext(d Discovery, key ItemKey) ErrorContext {
+	switch d := d.(type) {
+	case *resolution:
+		path := d.path()
+		if d.key != key {
+			path = append(path, key)
+		}
+		return ErrorContext{Path: path, Layer: d.ItemDiscovery.layer()}
+	case *ItemDiscovery:
+		return ErrorContext{Path: ResolvePath{key}, Layer: d.layer()}
+	}
+
+	return ErrorContext{Path: ResolvePath{key}}
+}
+
+// errorContext returns the ErrorContext of an error about key that occurred
+// in d while resolving parent
+func (d *ItemDiscovery) errorContext(parent *resolution, key ItemKey) ErrorContext {
+	return ErrorContext{Path: pathTo(parent, key), Layer: d.layer()}
+}
+
+// NotFoundError is returned when an item has no mapping and no existing item
+type NotFoundError struct {
+	ErrorContext
+	Type reflect.Type
+	Name string
+
+	template error
+}
+
+func newNotFoundError(ctx ErrorContext, key ItemKey) error {
+	return &NotFoundError{ErrorContext: ctx, Type: key.Type, Name: key.Name, template: ErrItemNotFound.Instance(key)}
+}
+
+func (e *NotFoundError) Error() string        { return e.template.Error() + e.describe() }
+func (e *NotFoundError) Unwrap() error        { return e.template }
+func (e *NotFoundError) Is(target error) bool { return target == ErrNotFound }
+
+// ResolveError is returned when an item has a mapping that failed to resolve
+//
+//	Notes
+//		Cause is the error returned by the Creator (or AO creator), a
+//		*PanicError if it panicked, or the error of the context of the
+//		resolution
+type ResolveError struct {
+	ErrorContext
+	Type  reflect.Type
+	Name  string
+	Cause error
+
+	template error
+}
+
+// newResolveError creates a ResolveError. source identifies an AO mapping
+// that failed, and is empty for the mapping of key
+func newResolveError(ctx ErrorContext, key ItemKey, cause error, source string) error {
+	var template error
+	if source == "" {
+		template = ErrItemNotResolved.Instance(key, cause).WithInner(cause)
+	} else {
+		template = ErrItemNotResolved.Instancef("%s failed resolve: %s", source, cause).WithInner(cause)
+	}
+
+	return &ResolveError{ErrorContext: ctx, Type: key.Type, Name: key.Name, Cause: cause, template: template}
+}
+
+func (e *ResolveError) Error() string        { return e.template.Error() }
+func (e *ResolveError) Unwrap() []error      { return []error{e.template, e.Cause} }
+func (e *ResolveError) Is(target error) bool { return target == ErrNotResolved }
+
+// CircularDependencyError is returned when resolving an item requires the
+// item itself
+//
+//	Notes
+//		Path is the circular path, which starts and ends with the item
+type CircularDependencyError struct {
+	ErrorContext
+	Type reflect.Type
+	Name string
+
+	template error
+}
+
+func newCircularDependencyError(ctx ErrorContext, key ItemKey) error {
+	return &CircularDependencyError{
+		ErrorContext: ctx,
+		Type:         key.Type,
+		Name:         key.Name,
+		template:     ErrCircularResolveDependency.Instance(key, ctx.Path),
+	}
+}
+
+func (e *CircularDependencyError) Error() string {
+	return e.template.Error() + fmt.Sprintf(" (in layer %d)", e.Layer)
+}
+func (e *CircularDependencyError) Unwrap() error        { return e.template }
+func (e *CircularDependencyError) Is(target error) bool { return target == ErrCircularDependency }
+
+// ItemTypeError is returned when an item is not of the item type it is
+// added or resolved as
+type ItemTypeError struct {
+	ErrorContext
+	Type   reflect.Type
+	Actual reflect.Type
+
+	template error
+}
+
+// newItemTypeError creates an ItemTypeError. source identifies the mapping
+// that created item, and is empty for items that were not created by
+// discovery
+func newItemTypeError(ctx ErrorContext, itemType reflect.Type, item interface{}, source string) error {
+	actual := reflect.TypeOf(item)
+
+	var template error
+	if source == "" {
+		template = ErrItemNotItemType.Instance(typeName(itemType))
+	} else {
+		template = ErrItemNotItemType.Instancef("%s created %s, which is not of type %s", source, typeName(actual), typeName(itemType))
+	}
+
+	return &ItemTypeError{ErrorContext: ctx, Type: itemType, Actual: actual, template: template}
+}
+
+func (e *ItemTypeError) Error() string        { return e.template.Error() + e.describe() }
+func (e *ItemTypeError) Unwrap() error        { return e.template }
+func (e *ItemTypeError) Is(target error) bool { return target == ErrNotItemType }
+
+// LifetimeError is returned when resolve options conflict with the lifetime
+// declared by the mapping of an item
+type LifetimeError struct {
+	ErrorContext
+	Type     reflect.Type
+	Name     string
+	Lifetime Lifetime
+
+	template error
+}
+
+func newLifetimeError(ctx ErrorContext, key ItemKey, lt Lifetime, option string) error {
+	return &LifetimeError{
+		ErrorContext: ctx,
+		Type:         key.Type,
+		Name:         key.Name,
+		Lifetime:     lt,
+		template:     ErrLifetimeConflict.Instance(key, lt, option),
+	}
+}
+
+func (e *LifetimeError) Error() string        { return e.template.Error() + e.describe() }
+func (e *LifetimeError) Unwrap() error        { return e.template }
+func (e *LifetimeError) Is(target error) bool { return target == ErrLifetime }
+
+// pathTo returns the resolution path of parent extended with key
+func pathTo(parent *resolution, key ItemKey) ResolvePath {
+	if parent == nil {
+		return ResolvePath{key}
+	}
+
+	return append(parent.path(), key)
+}
+
+// layer returns the depth of d in its chain of base discoveries
+func (d *ItemDiscovery) layer() int {
+	switch base := d.baseDiscovery.(type) {
+	case nil:
+		return 0
+	case layered:
+		return base.layer() + 1
+	}
+
+	return 1
+}
+
+// layered is implemented by discoveries that know their layer
+type layered interface {
+	layer() int
+}
+
+// typeName returns the fully qualified name of t, e.g.
+// *github.com/gotomgo/discovery.ItemDiscovery
+func typeName(t reflect.Type) string {
+	if t == nil {
+		return "<nil>"
+	}
+
+	if (t.Name() != "") && (t.PkgPath() != "") {
+		return t.PkgPath() + "." + t.Name()
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return "*" + typeName(t.Elem())
+	case reflect.Slice:
+		return "[]" + typeName(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), typeName(t.Elem()))
+	case reflect.Map:
+		return fmt.Sprintf("map[%s]%s", typeName(t.Key()), typeName(t.Elem()))
+	case reflect.Chan:
+		return t.ChanDir().String() + " " + typeName(t.Elem())
+	}
+
+	return t.String()
+}
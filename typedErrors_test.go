@@ -0,0 +1,119 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedErrors(t *testing.T) {
+	failed := errors.New("failed")
+
+	resolver := NewBaseItemResolver()
+	resolver.AddMappingsVar(
+		ResolverMapping{Type: cycleAType, Creator: dependsOn(cycleBType)},
+		ResolverMapping{Type: cycleBType, Creator: dependsOn(testItemType)},
+		ResolverMapping{Type: cycleCType, Creator: func(d Discovery) (interface{}, error) {
+			return nil, failed
+		}})
+
+	d := NewItemDiscovery(resolver)
+
+	// not found, at the end of a resolution chain
+	_, err := d.GetItem(cycleAType)
+	assert.ErrorIs(t, err, ErrNotResolved)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NotErrorIs(t, err, ErrCircularDependency)
+
+	var notFound *NotFoundError
+	if assert.ErrorAs(t, err, &notFound) {
+		assert.Equal(t, testItemType, notFound.Type)
+		assert.Equal(t, ResolvePath{TypeKey(cycleAType), TypeKey(cycleBType), TypeKey(testItemType)}, notFound.Path)
+	}
+
+	var resolveErr *ResolveError
+	if assert.ErrorAs(t, err, &resolveErr) {
+		assert.Equal(t, cycleAType, resolveErr.Type)
+		assert.ErrorIs(t, resolveErr.Cause, ErrNotResolved)
+	}
+
+	// the cause of a resolve error is preserved
+	_, err = d.GetItem(cycleCType)
+	assert.ErrorIs(t, err, failed)
+	assert.ErrorIs(t, err, ErrNotResolved)
+
+	// the coreutils message is preserved
+	_, err = d.GetItem(testItemType)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Equal(t, ErrItemNotFound.Instance(TypeKey(testItemType)).Error(), err.Error())
+
+	var typeErr *ItemTypeError
+	err = d.AddItem(MockServiceType, "not a service")
+	if assert.ErrorAs(t, err, &typeErr) {
+		assert.ErrorIs(t, err, ErrNotItemType)
+		assert.Equal(t, MockServiceType, typeErr.Type)
+		assert.Equal(t, TypeOf[string](), typeErr.Actual)
+	}
+
+	resolver.AddMapping(ResolverMapping{Type: testItemType, Creator: dependsOn(cycleAType)})
+
+	var circular *CircularDependencyError
+	_, err = d.GetItem(cycleAType)
+	if assert.ErrorAs(t, err, &circular) {
+		assert.ErrorIs(t, err, ErrCircularDependency)
+		assert.Equal(t, 4, len(circular.Path))
+	}
+}
+
+func TestErrorContext(t *testing.T) {
+	baseResolver := NewBaseItemResolver()
+	baseResolver.AddMapping(ResolverMapping{Type: cycleBType, Creator: dependsOn(testItemType)})
+	base := NewItemDiscovery(baseResolver)
+
+	resolver := NewBaseItemResolver()
+	resolver.AddMapping(ResolverMapping{Type: cycleAType, Creator: dependsOn(cycleBType), Lifetime: LtScoped})
+	super := NewItemDiscoveryWithBase(base, resolver)
+
+	// the failure happens in the base discovery, which owns the mapping of B
+	_, err := super.GetItem(cycleAType)
+	var notFound *NotFoundError
+	if assert.ErrorAs(t, err, &notFound) {
+		assert.Equal(t, ResolvePath{TypeKey(cycleAType), TypeKey(cycleBType), TypeKey(testItemType)}, notFound.Path)
+		assert.Equal(t, 0, notFound.Layer)
+	}
+
+	var resolveErr *ResolveError
+	if assert.ErrorAs(t, err, &resolveErr) {
+		assert.Equal(t, ResolvePath{TypeKey(cycleAType)}, resolveErr.Path)
+		assert.Equal(t, 1, resolveErr.Layer)
+	}
+
+	assert.Contains(t, err.Error(), ResolvePath{TypeKey(cycleAType), TypeKey(cycleBType), TypeKey(testItemType)}.String())
+	assert.Contains(t, err.Error(), typeName(testItemType))
+
+	// lifetime conflicts carry the context of the discovery that detected them
+	_, err = super.GetItemWithOptions(cycleAType, RoInstanceItem)
+	var lifetimeErr *LifetimeError
+	if assert.ErrorAs(t, err, &lifetimeErr) {
+		assert.ErrorIs(t, err, ErrLifetime)
+		assert.Equal(t, LtScoped, lifetimeErr.Lifetime)
+		assert.Equal(t, 1, lifetimeErr.Layer)
+	}
+
+	// context errors are resolve errors
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = super.GetItemContext(ctx, cycleAType)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorIs(t, err, ErrNotResolved)
+}
+
+func TestTypeName(t *testing.T) {
+	assert.Equal(t, "*github.com/gotomgo/discovery.ItemDiscovery", typeName(TypeOf[*ItemDiscovery]()))
+	assert.Equal(t, "[]github.com/gotomgo/discovery.ItemKey", typeName(TypeOf[[]ItemKey]()))
+	assert.Equal(t, "map[string]github.com/gotomgo/discovery.Lifetime", typeName(TypeOf[map[string]Lifetime]()))
+	assert.Equal(t, "string", typeName(TypeOf[string]()))
+	assert.Equal(t, "github.com/gotomgo/discovery.ItemKey[primary]", NamedKey(TypeOf[ItemKey](), "primary").String())
+}
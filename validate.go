@@ -0,0 +1,287 @@
+package discovery
+
+import (
+	stderrors "errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidateOptions represents flag values used by Validate
+type ValidateOptions int
+
+const (
+	// VoNone represents no validate options: only declared dependencies are
+	// checked
+	VoNone ValidateOptions = 0
+	// VoResolve is used to indicate that every mapping should actually be
+	// resolved. Resolved items are cached according to their lifetime
+	VoResolve ValidateOptions = 1 << 0
+)
+
+// ProblemKind identifies the kind of a ValidationProblem
+type ProblemKind int
+
+const (
+	// ProblemMissingDependency indicates a declared dependency that has no
+	// item and no mapping
+	ProblemMissingDependency ProblemKind = iota
+	// ProblemCircularDependency indicates a cycle of declared dependencies
+	ProblemCircularDependency
+	// ProblemResolveFailed indicates a mapping that failed to resolve
+	// (VoResolve only)
+	ProblemResolveFailed
+)
+
+// String returns the name of the problem kind
+func (k ProblemKind) String() string {
+	switch k {
+	case ProblemMissingDependency:
+		return "missing dependency"
+	case ProblemCircularDependency:
+		return "circular dependency"
+	case ProblemResolveFailed:
+		return "resolve failed"
+	}
+
+	return "unknown"
+}
+
+// ValidationProblem is a problem found by Validate
+//
+//	Notes
+//		Dependency is set for ProblemMissingDependency, Path is set for
+//		ProblemCircularDependency and Err is set for ProblemResolveFailed
+type ValidationProblem struct {
+	Kind       ProblemKind
+	Key        ItemKey
+	Dependency ItemKey
+	Path       ResolvePath
+	Err        error
+}
+
+// String returns a description of the problem
+func (p ValidationProblem) String() string {
+	switch p.Kind {
+	case ProblemMissingDependency:
+		return fmt.Sprintf("%s: %s depends on %s", p.Kind, p.Key, p.Dependency)
+	case ProblemCircularDependency:
+		return fmt.Sprintf("%s: %s", p.Kind, p.Path)
+	case ProblemResolveFailed:
+		return fmt.Sprintf("%s: %s: %s", p.Kind, p.Key, p.Err)
+	}
+
+	return fmt.Sprintf("%s: %s", p.Kind, p.Key)
+}
+
+// ValidationReport is the result of Validate
+type ValidationReport struct {
+	Problems []ValidationProblem
+}
+
+// OK returns true if no problems were found
+func (r *ValidationReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Err returns the problems as an error, or nil if no problems were found
+func (r *ValidationReport) Err() error {
+	if r.OK() {
+		return nil
+	}
+
+	errs := make([]error, len(r.Problems))
+	for i, problem := range r.Problems {
+		errs[i] = ErrValidationFailed.Instance(problem).WithInner(problem.Err)
+	}
+
+	return stderrors.Join(errs...)
+}
+
+// String returns a description of every problem, one per line
+func (r *ValidationReport) String() string {
+	lines := make([]string, len(r.Problems))
+	for i, problem := range r.Problems {
+		lines[i] = problem.String()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// mappingLister is implemented by resolvers that can list their mappings
+type mappingLister interface {
+	Mappings() []ResolverMapping
+	AOMappings() []AOResolverMapping
+}
+
+// Validate checks the declared dependencies of every mapping of the
+// BaseItemResolver
+//
+//	Notes
+//		Only the mappings of the BaseItemResolver can satisfy dependencies, so
+//		dependencies on items added to discovery are reported as missing. Use
+//		ItemDiscovery.Validate to take them into account
+func (r *BaseItemResolver) Validate() *ValidationReport {
+	v := newValidator()
+	v.addResolver(r)
+
+	return v.validate(v.hasMapping)
+}
+
+// Validate checks the declared dependencies of every mapping of discovery
+// and its base discoveries
+//
+//	Notes
+//		Dependencies are satisfied by items and mappings of discovery and its
+//		base discoveries. Mappings without declared dependencies are only
+//		checked with VoResolve
+func (d *ItemDiscovery) Validate(options ValidateOptions) *ValidationReport {
+	v := newValidator()
+
+	for layer := Discovery(d); layer != nil; {
+		id, ok := layer.(*ItemDiscovery)
+		if !ok {
+			break
+		}
+
+		if lister, ok := id.resolver.(mappingLister); ok {
+			v.addResolver(lister)
+		}
+
+		layer = id.baseDiscovery
+	}
+
+	report := v.validate(func(key ItemKey) bool {
+		return v.hasMapping(key) || canAcquire(d, key)
+	})
+
+	if (options & VoResolve) != 0 {
+		for _, key := range v.keys() {
+			if _, err := d.GetKeyedItem(key); err != nil {
+				report.Problems = append(report.Problems, ValidationProblem{Kind: ProblemResolveFailed, Key: key, Err: err})
+			}
+		}
+	}
+
+	return report
+}
+
+// validator checks declared dependencies
+//
+//	Notes
+//		The dependencies of AO mappings are kept apart from deps, keyed by the
+//		AO type, so that they are checked even if the wrapped item has no
+//		mapping (e.g. it is added, or mapped by a base discovery)
+type validator struct {
+	deps   map[ItemKey][]ItemKey
+	aoDeps map[ItemKey][]ItemKey
+}
+
+func newValidator() *validator {
+	return &validator{deps: map[ItemKey][]ItemKey{}, aoDeps: map[ItemKey][]ItemKey{}}
+}
+
+// addResolver adds the mappings of a resolver. Mappings that were already
+// added by a super discovery take precedence
+func (v *validator) addResolver(lister mappingLister) {
+	for _, mapping := range lister.Mappings() {
+		if _, ok := v.deps[mapping.Key()]; !ok {
+			v.deps[mapping.Key()] = append([]ItemKey{}, mapping.Dependencies...)
+		}
+	}
+
+	// AO dependencies are dependencies of the item they wrap
+	for _, mapping := range lister.AOMappings() {
+		key := TypeKey(mapping.Type)
+		v.aoDeps[key] = append(v.aoDeps[key], mapping.Dependencies...)
+	}
+}
+
+// dependencies returns the dependencies of key, including the dependencies
+// of its AO mappings
+func (v *validator) dependencies(key ItemKey) []ItemKey {
+	return append(append([]ItemKey{}, v.deps[key]...), v.aoDeps[key]...)
+}
+
+func (v *validator) hasMapping(key ItemKey) bool {
+	_, ok := v.deps[key]
+	return ok
+}
+
+// keys returns the mapped keys in a stable order
+func (v *validator) keys() []ItemKey {
+	return sortKeys(v.deps, nil)
+}
+
+// checkedKeys returns the keys with a mapping or an AO mapping in a stable
+// order
+func (v *validator) checkedKeys() []ItemKey {
+	return sortKeys(v.deps, v.aoDeps)
+}
+
+// sortKeys returns the keys of both maps in a stable order
+func sortKeys(deps map[ItemKey][]ItemKey, more map[ItemKey][]ItemKey) []ItemKey {
+	keys := make([]ItemKey, 0, len(deps)+len(more))
+	for key := range deps {
+		keys = append(keys, key)
+	}
+	for key := range more {
+		if _, ok := deps[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
+	return keys
+}
+
+func (v *validator) validate(available func(key ItemKey) bool) *ValidationReport {
+	report := &ValidationReport{}
+
+	for _, key := range v.checkedKeys() {
+		for _, dep := range v.dependencies(key) {
+			if !available(dep) {
+				report.Problems = append(report.Problems, ValidationProblem{Kind: ProblemMissingDependency, Key: key, Dependency: dep})
+			}
+		}
+	}
+
+	// depth first search for cycles, each cycle is reported once
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := map[ItemKey]int{}
+	var stack ResolvePath
+
+	var visit func(key ItemKey)
+	visit = func(key ItemKey) {
+		state[key] = visiting
+		stack = append(stack, key)
+
+		for _, dep := range v.dependencies(key) {
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case visiting:
+				path := append(ResolvePath{}, stack...)
+				path = append(path, dep)
+				report.Problems = append(report.Problems, ValidationProblem{Kind: ProblemCircularDependency, Key: dep, Path: trimCycle(path)})
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		state[key] = visited
+	}
+
+	for _, key := range v.checkedKeys() {
+		if state[key] == unvisited {
+			visit(key)
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,88 @@
+package discovery
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	resolver := NewBaseItemResolver()
+	resolver.AddMappingsVar(
+		ResolverMapping{Type: cycleAType, Creator: dependsOn(cycleBType), Dependencies: []ItemKey{TypeKey(cycleBType)}},
+		ResolverMapping{Type: cycleBType, Creator: dependsOn(cycleAType), Dependencies: []ItemKey{TypeKey(cycleAType)}},
+		ResolverMapping{Type: cycleCType, Creator: dependsOn(testItemType), Dependencies: []ItemKey{TypeKey(testItemType)}})
+
+	report := resolver.Validate()
+	assert.False(t, report.OK())
+	assert.Error(t, report.Err())
+
+	if assert.Len(t, report.Problems, 2) {
+		assert.Equal(t, ProblemMissingDependency, report.Problems[0].Kind)
+		assert.Equal(t, TypeKey(cycleCType), report.Problems[0].Key)
+		assert.Equal(t, TypeKey(testItemType), report.Problems[0].Dependency)
+
+		assert.Equal(t, ProblemCircularDependency, report.Problems[1].Kind)
+		assert.Equal(t, ResolvePath{TypeKey(cycleAType), TypeKey(cycleBType), TypeKey(cycleAType)}, report.Problems[1].Path)
+	}
+
+	// items of discovery (and its base) satisfy dependencies
+	d := NewItemDiscovery(nil)
+	assert.NoError(t, d.AddItem(testItemType, &testItemImpl{}))
+
+	superD := NewItemDiscoveryWithBase(d, resolver)
+	report = superD.Validate(VoNone)
+	assert.Len(t, report.Problems, 1)
+	assert.Contains(t, report.String(), "circular dependency")
+}
+
+func TestValidateResolve(t *testing.T) {
+	failed := errors.New("failed")
+
+	d := NewItemDiscovery(nil)
+	d.GetResolver().AddMappingsVar(
+		ResolverMapping{Type: cycleAType, Creator: dependsOn()},
+		ResolverMapping{Type: cycleBType, Creator: func(d Discovery) (interface{}, error) {
+			return nil, failed
+		}})
+
+	assert.True(t, d.Validate(VoNone).OK())
+
+	report := d.Validate(VoResolve)
+	if assert.Len(t, report.Problems, 1) {
+		assert.Equal(t, ProblemResolveFailed, report.Problems[0].Kind)
+		assert.Equal(t, TypeKey(cycleBType), report.Problems[0].Key)
+	}
+
+	assert.True(t, d.HasItem(cycleAType))
+}
+
+func TestValidateAOMappings(t *testing.T) {
+	base := NewItemDiscovery(nil)
+	base.GetResolver().AddMapping(ResolverMapping{Type: cycleBType, Creator: dependsOn()})
+
+	// the wrapped items are not mapped by the resolver of the AO mappings
+	resolver := NewBaseItemResolver()
+	resolver.AddAOMappings([]AOResolverMapping{
+		{Type: cycleAType, Dependencies: []ItemKey{TypeKey(cycleCType)}},
+		{Type: cycleBType, Dependencies: []ItemKey{TypeKey(testItemType)}}})
+
+	superD := NewItemDiscoveryWithBase(base, resolver)
+
+	report := superD.Validate(VoNone)
+	if assert.Len(t, report.Problems, 2) {
+		assert.Equal(t, ProblemMissingDependency, report.Problems[0].Kind)
+		assert.Equal(t, TypeKey(cycleAType), report.Problems[0].Key)
+		assert.Equal(t, TypeKey(cycleCType), report.Problems[0].Dependency)
+
+		assert.Equal(t, TypeKey(cycleBType), report.Problems[1].Key)
+		assert.Equal(t, TypeKey(testItemType), report.Problems[1].Dependency)
+	}
+
+	assert.Len(t, resolver.Validate().Problems, 2)
+
+	assert.NoError(t, base.AddItem(cycleCType, &testItemImpl{}))
+	assert.NoError(t, base.AddItem(testItemType, &testItemImpl{}))
+	assert.True(t, superD.Validate(VoNone).OK())
+}
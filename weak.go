@@ -0,0 +1,55 @@
+package discovery
+
+import "weak"
+
+// weakSet is a set of weakly referenced values, so that values that are
+// dropped without being removed can be collected
+//
+//	Notes
+//		weak pointers require Go 1.24, which is the minimum Go version of the
+//		module
+//
+//		weakSet is not synchronized. The entries of collected values are
+//		pruned as values are added, which bounds the set by the number of
+//		live values rather than the number of values ever added
+type weakSet[T any] struct {
+	values  map[weak.Pointer[T]]struct{}
+	pruneAt int
+}
+
+func (s *weakSet[T]) add(v *T) {
+	if s.values == nil {
+		s.values = map[weak.Pointer[T]]struct{}{}
+	}
+
+	if len(s.values) >= s.pruneAt {
+		for p := range s.values {
+			if p.Value() == nil {
+				delete(s.values, p)
+			}
+		}
+		s.pruneAt = 2*len(s.values) + 16
+	}
+
+	s.values[weak.Make(v)] = struct{}{}
+}
+
+func (s *weakSet[T]) remove(v *T) {
+	delete(s.values, weak.Make(v))
+}
+
+// live returns the values that have not been collected
+func (s *weakSet[T]) live() []*T {
+	result := make([]*T, 0, len(s.values))
+	for p := range s.values {
+		if v := p.Value(); v != nil {
+			result = append(result, v)
+		}
+	}
+
+	return result
+}
+
+func (s *weakSet[T]) len() int {
+	return len(s.values)
+}